@@ -0,0 +1,370 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"delsanchez.gl/internal/jsonlog"
+	"delsanchez.gl/internal/validator"
+)
+
+// The configuration is read from three layers. Each setting is identified by its flag
+// name (e.g. "db-max-idle-time"), and the value of a setting comes from the first of
+// these which provides it:
+//
+//  1. the command-line flag, e.g. -db-max-idle-time=5m
+//  2. the environment variable GREENLIGHT_<NAME>, with the name upper-cased and dashes
+//     replaced by underscores, e.g. GREENLIGHT_DB_MAX_IDLE_TIME=5m
+//  3. the JSON config file given by -config (or GREENLIGHT_CONFIG), which is a flat
+//     object keyed by flag name, e.g. {"db-max-idle-time": "5m"}
+//
+// falling back to the flag's default value if none of them do. Every value goes
+// through the same flag.Value.Set() parsing, whichever layer it comes from.
+const envPrefix = "GREENLIGHT_"
+
+// The flags which control the program itself rather than being settings, so they're
+// never read from the environment or the config file, and aren't printed.
+var nonSettings = map[string]bool{
+	"config":  true,
+	"version": true,
+}
+
+// The secret settings, which `api config print` redacts.
+var secretSettings = map[string]bool{
+	"db-dsn":        true,
+	"smtp-password": true,
+}
+
+// A configError holds the per-key problems found while loading the configuration.
+type configError struct {
+	errors map[string]string
+}
+
+func (e *configError) Error() string {
+	keys := make([]string, 0, len(e.errors))
+	for key := range e.errors {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteString("invalid configuration:")
+	for _, key := range keys {
+		fmt.Fprintf(&b, "\n  %s: %s", key, e.errors[key])
+	}
+	return b.String()
+}
+
+// A stringList is a flag.Value for a space-separated list of strings. We use the
+// strings.Fields() function to split the value, so an empty string (or one which only
+// contains whitespace) results in an empty list.
+type stringList []string
+
+func (l *stringList) String() string {
+	if l == nil {
+		return ""
+	}
+	return strings.Join(*l, " ")
+}
+
+func (l *stringList) Set(val string) error {
+	*l = strings.Fields(val)
+	return nil
+}
+
+func (l *stringList) Get() any {
+	if *l == nil {
+		return []string{}
+	}
+	return []string(*l)
+}
+
+// defineFlags() declares all the configuration flags on fs, reading their values into
+// cfg.
+func defineFlags(fs *flag.FlagSet, cfg *config) {
+	fs.StringVar(&cfg.file, "config", "", "Path to a JSON config file (env: GREENLIGHT_CONFIG)")
+	fs.BoolVar(&cfg.displayVersion, "version", false, "Display version and build information and exit")
+
+	// Read the value of the port and env command-line flag into the config struct.
+	// default is using 4000 and the enviroment "development" if no
+	// correspanding flags are provided.
+	fs.IntVar(&cfg.port, "port", 4000, "API server port")
+	fs.StringVar(&cfg.env, "env", "development", "Environment (development|staging|production)")
+	fs.DurationVar(&cfg.shutdownTimeout, "shutdown-timeout", 30*time.Second, "Grace period for in-flight requests during shutdown")
+	fs.StringVar(&cfg.log.level, "log-level", "info", "Minimum log level (debug|info|warn|error|fatal|off)")
+	fs.StringVar(&cfg.log.format, "log-format", "json", "Log output format (text|json)")
+
+	// Select the storage backend. The memory backend doesn't need a database at all.
+	fs.StringVar(&cfg.storage, "storage", "postgres", "Storage backend (memory|postgres)")
+
+	// Read the DSN value from the db-dsn command-line flag into the config struct.
+	fs.StringVar(&cfg.db.dsn, "db-dsn", "", "PostgreSQL DSN")
+
+	// Read the connection pool settings from the command-line flags into the config struct.
+	// Note the default values I'm using.
+	fs.IntVar(&cfg.db.maxOpenConns, "db-max-open-conns", 25, "PostgreSQL max open connections")
+	fs.IntVar(&cfg.db.maxIdleConns, "db-max-idle-conns", 25, "PostgreSQL max idle connections")
+	fs.StringVar(&cfg.db.maxIdleTime, "db-max-idle-time", "15m", "PostgreSQL max connection idle time")
+	fs.DurationVar(&cfg.db.queryTimeout, "db-query-timeout", 3*time.Second, "PostgreSQL query timeout")
+	fs.BoolVar(&cfg.db.autoMigrate, "db-auto-migrate", false, "Apply pending database migrations at startup")
+
+	// Read the rate limiter settings from the command-line flags into the config struct.
+	fs.Float64Var(&cfg.limiter.rps, "limiter-rps", 2, "Rate limiter maximum requests per second")
+	fs.IntVar(&cfg.limiter.burst, "limiter-burst", 4, "Rate limiter maximum burst")
+	fs.BoolVar(&cfg.limiter.enabled, "limiter-enabled", true, "Enable rate limiter")
+
+	// Read the response compression settings. Responses smaller than the minimum size
+	// are sent uncompressed, as compressing them isn't worth the CPU time.
+	fs.BoolVar(&cfg.compress.enabled, "compress-enabled", true, "Enable gzip and brotli response compression")
+	fs.IntVar(&cfg.compress.minSize, "compress-min-size", 1024, "Minimum response size in bytes to compress")
+
+	// The metrics include the database pool statistics and the number of goroutines,
+	// which aren't for the public, so they're only served when asked for.
+	fs.BoolVar(&cfg.metrics.enabled, "metrics-enabled", false, "Expose the application metrics at GET /debug/vars")
+
+	// Read the SMTP server configuration settings into the config struct. If no SMTP
+	// host is given, emails are captured in memory instead of being sent.
+	fs.StringVar(&cfg.smtp.host, "smtp-host", "", "SMTP host (leave empty to capture emails in memory)")
+	fs.IntVar(&cfg.smtp.port, "smtp-port", 25, "SMTP port")
+	fs.StringVar(&cfg.smtp.username, "smtp-username", "", "SMTP username")
+	fs.StringVar(&cfg.smtp.password, "smtp-password", "", "SMTP password")
+	fs.StringVar(&cfg.smtp.sender, "smtp-sender", "Greenlight <no-reply@greenlight.delsanchez.gl>", "SMTP sender")
+
+	// The trusted CORS origins are given as a single space-separated value.
+	fs.Var((*stringList)(&cfg.cors.trustedOrigins), "cors-trusted-origins", "Trusted CORS origins (space separated)")
+}
+
+// loadConfig() parses the command-line args, layers the environment variables (looked
+// up with getenv) and the config file underneath them, and validates the result. The
+// returned config is populated even when there's an error, so that it can still be
+// printed. Any problems with individual settings are reported together in a
+// *configError.
+func loadConfig(fs *flag.FlagSet, args []string, getenv func(string) string) (config, error) {
+	var cfg config
+
+	defineFlags(fs, &cfg)
+
+	err := fs.Parse(args)
+	if err != nil {
+		return cfg, err
+	}
+
+	// Keep track of the flags which were set explicitly on the command line, so that
+	// the other layers don't override them.
+	explicit := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+
+	v := validator.New()
+
+	if cfg.file == "" {
+		cfg.file = getenv(envPrefix + "CONFIG")
+	}
+
+	var fileValues map[string]string
+	if cfg.file != "" {
+		fileValues, err = readConfigFile(cfg.file)
+		if err != nil {
+			v.AddError("config", err.Error())
+		}
+	}
+
+	for key := range fileValues {
+		if nonSettings[key] || fs.Lookup(key) == nil {
+			v.AddError(key, fmt.Sprintf("unknown key in config file %s", cfg.file))
+		}
+	}
+
+	fs.VisitAll(func(f *flag.Flag) {
+		if explicit[f.Name] || nonSettings[f.Name] {
+			return
+		}
+
+		envName := envPrefix + strings.ToUpper(strings.ReplaceAll(f.Name, "-", "_"))
+
+		if value := getenv(envName); value != "" {
+			if err := fs.Set(f.Name, value); err != nil {
+				v.AddError(f.Name, fmt.Sprintf("invalid value %q from %s", value, envName))
+			}
+			return
+		}
+
+		if value, ok := fileValues[f.Name]; ok {
+			if err := fs.Set(f.Name, value); err != nil {
+				v.AddError(f.Name, fmt.Sprintf("invalid value %q from config file", value))
+			}
+		}
+	})
+
+	if validateConfig(v, cfg); !v.Valid() {
+		return cfg, &configError{errors: v.Errors}
+	}
+
+	return cfg, nil
+}
+
+// readConfigFile() reads a JSON config file and converts its values to the string form
+// that flag.Value.Set() expects. Lists (for cors-trusted-origins) are joined with
+// spaces.
+func readConfigFile(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	dec := json.NewDecoder(f)
+	// Decode numbers as json.Number so integers don't go through a float64.
+	dec.UseNumber()
+
+	var raw map[string]any
+	err = dec.Decode(&raw)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse config file %s: %w", path, err)
+	}
+
+	values := make(map[string]string, len(raw))
+
+	for key, value := range raw {
+		switch value := value.(type) {
+		case string:
+			values[key] = value
+		case json.Number:
+			values[key] = value.String()
+		case bool:
+			values[key] = strconv.FormatBool(value)
+		case []any:
+			items := make([]string, 0, len(value))
+			for _, item := range value {
+				s, ok := item.(string)
+				if !ok {
+					return nil, fmt.Errorf("config file %s: %s must be a list of strings", path, key)
+				}
+				items = append(items, s)
+			}
+			values[key] = strings.Join(items, " ")
+		default:
+			return nil, fmt.Errorf("config file %s: %s has an unsupported value type", path, key)
+		}
+	}
+
+	return values, nil
+}
+
+// validateConfig() checks the merged configuration up front, so that bad values are
+// reported clearly at startup instead of surfacing somewhere deep inside openDB() or
+// the middleware. The error keys are the flag names.
+func validateConfig(v *validator.Validator, cfg config) {
+	v.Check(cfg.port >= 1 && cfg.port <= 65535, "port", "must be between 1 and 65535")
+	v.Check(validator.PermittedValue(cfg.env, "development", "staging", "production"), "env", "must be one of development|staging|production")
+	v.Check(cfg.shutdownTimeout > 0, "shutdown-timeout", "must be greater than zero")
+
+	_, err := jsonlog.ParseLevel(cfg.log.level)
+	v.Check(err == nil, "log-level", "must be one of debug|info|warn|error|fatal|off")
+	_, err = jsonlog.ParseFormat(cfg.log.format)
+	v.Check(err == nil, "log-format", "must be one of text|json")
+
+	v.Check(validator.PermittedValue(cfg.storage, "memory", "postgres"), "storage", "must be one of memory|postgres")
+	if cfg.storage == "postgres" {
+		v.Check(cfg.db.dsn != "", "db-dsn", "must be provided")
+	}
+	duration, err := time.ParseDuration(cfg.db.maxIdleTime)
+	v.Check(err == nil, "db-max-idle-time", "must be a valid duration, such as 15m or 1h")
+	v.Check(duration >= 0, "db-max-idle-time", "must not be negative")
+	v.Check(cfg.db.queryTimeout > 0, "db-query-timeout", "must be greater than zero")
+
+	if cfg.limiter.enabled {
+		v.Check(cfg.limiter.rps > 0, "limiter-rps", "must be greater than zero")
+		v.Check(cfg.limiter.burst >= 1, "limiter-burst", "must be at least 1")
+	}
+
+	if cfg.compress.enabled {
+		v.Check(cfg.compress.minSize >= 0, "compress-min-size", "must not be negative")
+	}
+
+	if cfg.smtp.host != "" {
+		v.Check(cfg.smtp.port >= 1 && cfg.smtp.port <= 65535, "smtp-port", "must be between 1 and 65535")
+		v.Check(cfg.smtp.sender != "", "smtp-sender", "must be provided")
+	}
+
+	for _, origin := range cfg.cors.trustedOrigins {
+		u, err := url.Parse(origin)
+		ok := err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "" && u.Path == "" && u.RawQuery == ""
+		v.Check(ok, "cors-trusted-origins", fmt.Sprintf("%q is not a valid origin (e.g. https://www.example.com)", origin))
+	}
+}
+
+// printConfig() writes the effective configuration to out as a JSON object, in the
+// same format as the config file. Secrets are redacted.
+func printConfig(fs *flag.FlagSet, out io.Writer) error {
+	values := make(map[string]any)
+
+	fs.VisitAll(func(f *flag.Flag) {
+		if nonSettings[f.Name] {
+			return
+		}
+
+		var value any = f.Value.String()
+		if getter, ok := f.Value.(flag.Getter); ok {
+			switch v := getter.Get().(type) {
+			case int, float64, bool, []string:
+				value = v
+			}
+		}
+
+		if secretSettings[f.Name] {
+			value = redact(f.Value.String())
+		}
+
+		values[f.Name] = value
+	})
+
+	// Don't escape the < and > characters (which appear in smtp-sender).
+	enc := json.NewEncoder(out)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "\t")
+
+	return enc.Encode(values)
+}
+
+var dsnPasswordRX = regexp.MustCompile(`(password=)('[^']*'|\S+)`)
+
+// redact() hides a secret value. For a DSN we keep everything except the password, as
+// the rest (host, database name...) is useful when checking the configuration.
+func redact(value string) string {
+	if value == "" {
+		return ""
+	}
+
+	if u, err := url.Parse(value); err == nil && u.Scheme != "" && u.Host != "" {
+		if _, hasPassword := u.User.Password(); hasPassword {
+			u.User = url.UserPassword(u.User.Username(), "REDACTED")
+		}
+		return u.String()
+	}
+
+	if dsnPasswordRX.MatchString(value) {
+		return dsnPasswordRX.ReplaceAllString(value, "${1}REDACTED")
+	}
+
+	return "REDACTED"
+}
+
+// runConfig() handles the `api config` subcommand.
+func runConfig(fs *flag.FlagSet, args []string, out io.Writer) error {
+	if len(args) != 1 || args[0] != "print" {
+		return errors.New("usage: api config print")
+	}
+	return printConfig(fs, out)
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"delsanchez.gl/internal/data"
+	"delsanchez.gl/internal/render"
+)
+
+// Define a custom contextKey type, with the underlying type string.
+type contextKey string
+
+// Convert the string "user" to a contextKey type and assign it to the userContextKey
+// constant. We'll use this constant as the key for getting and setting user
+// information in the request context.
+const userContextKey = contextKey("user")
+
+// requestIDContextKey is the key for the request ID set by the requestID() middleware.
+const requestIDContextKey = contextKey("request_id")
+
+// formatContextKey is the key for the response format chosen by the negotiate()
+// middleware.
+const formatContextKey = contextKey("format")
+
+// runtimeStyleContextKey is the key for the runtime style set by the runtimeStyle()
+// middleware.
+const runtimeStyleContextKey = contextKey("runtime_style")
+
+// The contextSetUser() method returns a new copy of the request with the provided
+// User struct added to the context.
+func (app *application) contextSetUser(r *http.Request, user *data.User) *http.Request {
+	ctx := context.WithValue(r.Context(), userContextKey, user)
+	return r.WithContext(ctx)
+}
+
+// The contextGetUser() retrieves the User struct from the request context. The only
+// time that we'll use this helper is when we logically expect there to be User struct
+// value in the context, and if it doesn't exist it will firmly be an 'unexpected'
+// error. So it's OK to panic in those circumstances.
+func (app *application) contextGetUser(r *http.Request) *data.User {
+	user, ok := r.Context().Value(userContextKey).(*data.User)
+	if !ok {
+		panic("missing user value in request context")
+	}
+
+	return user
+}
+
+// The contextSetRequestID() method returns a new copy of the request with the given
+// request ID added to the context.
+func (app *application) contextSetRequestID(r *http.Request, id string) *http.Request {
+	ctx := context.WithValue(r.Context(), requestIDContextKey, id)
+	return r.WithContext(ctx)
+}
+
+// The contextGetRequestID() method retrieves the request ID from the request context.
+// Unlike contextGetUser(), a missing value isn't a bug: it's used while logging and
+// sending errors, which can happen before the requestID() middleware has run. So it
+// returns an empty string instead of panicking.
+func (app *application) contextGetRequestID(r *http.Request) string {
+	id, _ := r.Context().Value(requestIDContextKey).(string)
+	return id
+}
+
+// The contextSetRuntimeStyle() method returns a new copy of the request with the given
+// runtime style added to the context.
+func (app *application) contextSetRuntimeStyle(r *http.Request, style data.RuntimeStyle) *http.Request {
+	ctx := context.WithValue(r.Context(), runtimeStyleContextKey, style)
+	return r.WithContext(ctx)
+}
+
+// The contextGetRuntimeStyle() method retrieves the runtime style from the request
+// context. If there isn't one (the client didn't ask for a style, or the route doesn't
+// use the runtimeStyle() middleware), it returns the default style.
+func (app *application) contextGetRuntimeStyle(r *http.Request) data.RuntimeStyle {
+	style, ok := r.Context().Value(runtimeStyleContextKey).(data.RuntimeStyle)
+	if !ok {
+		return data.RuntimeStyleMins
+	}
+
+	return style
+}
+
+// The contextSetFormat() method returns a new copy of the request with the given
+// response format added to the context.
+func (app *application) contextSetFormat(r *http.Request, format *render.Format) *http.Request {
+	ctx := context.WithValue(r.Context(), formatContextKey, format)
+	return r.WithContext(ctx)
+}
+
+// The contextGetFormat() method retrieves the response format from the request
+// context. The bool is false if the route doesn't use the negotiate() middleware, or
+// the response is sent before it has run.
+func (app *application) contextGetFormat(r *http.Request) (*render.Format, bool) {
+	format, ok := r.Context().Value(formatContextKey).(*render.Format)
+	return format, ok
+}
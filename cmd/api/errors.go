@@ -1,39 +1,85 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
+	"strings"
+
+	"delsanchez.gl/internal/render"
 )
 
-// A generic helper for logging an error message.
-// TODO: upgrade to structured logging, and record additional information
-// about the request including the HTTP method and url
+// A generic helper for logging an error message. Along with the error itself, we
+// record the request method, URI and remote address as properties of the log
+// entry, plus the request ID, so that the entry can be matched up with the response.
 func (app *application) logError(r *http.Request, err error) {
-	app.logger.Print(err)
+	app.logger.PrintError(err, app.requestProperties(r))
+}
+
+// requestProperties() returns the details of the request which go in log entries.
+func (app *application) requestProperties(r *http.Request) map[string]string {
+	properties := map[string]string{
+		"request_method": r.Method,
+		"request_uri":    r.URL.RequestURI(),
+		"remote_addr":    r.RemoteAddr,
+	}
+	if requestID := app.contextGetRequestID(r); requestID != "" {
+		properties["request_id"] = requestID
+	}
+
+	return properties
 }
 
 // The errorResponse() method is a generic helper for sending JSON-formatted error message to the client
 // with a given status code.
 // Note: I'm using "any" as the type for the "message" parameter rather than a string type,
 // as this will give me more flexibility over the values that I can include in the parameter.
+// ===================================================================================
+// The envelope also includes the request ID, which the client can quote when reporting
+// a problem, so that we can find the matching log entry.
 func (app *application) errorResponse(w http.ResponseWriter, r *http.Request, status int, message any) {
 	env := envelope{"error": message}
+	if requestID := app.contextGetRequestID(r); requestID != "" {
+		env["request_id"] = requestID
+	}
 
-	// Write the response using the writeJSON() helper. If this happens to return
+	// Write the response using the writeResponse() helper. If this happens to return
 	// an error, then log it, and fallback to sending the client an empty response with a
 	// 500 Internal Server Error status code.
-	err := app.writeJSON(w, status, env, nil)
+	err := app.writeResponse(w, r, status, env, nil)
 	if err != nil {
 		app.logError(r, err)
 		w.WriteHeader(500)
 	}
 }
 
+// statusClientClosedRequest is the status code nginx uses for a request which the
+// client canceled before the response was sent. net/http has no constant for it.
+const statusClientClosedRequest = 499
+
 // The serverErrorResponse() method will be used when the application encounter an unexpected
 // problem at runtime. It logs the detailed error message, then uses the errorResponse() helper to
 // send a 500 Internal Server Error status code and JSON response (containing a generic error message) to
 // the client.
+// ===================================================================================
+// Two kinds of errors from the models aren't unexpected problems, and are handled
+// here so that every handler gets them right: a query which timed out is sent as a
+// 504 Gateway Timeout, and a query which was canceled because the client went away
+// is only logged at debug level, as there is no one left to send a response to. It
+// still gets the (non-standard, but widely used) 499 Client Closed Request status, so
+// that the metrics don't count it as a success.
 func (app *application) serverErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, context.Canceled) && r.Context().Err() != nil:
+		app.logger.PrintDebug(err.Error(), app.requestProperties(r))
+		w.WriteHeader(statusClientClosedRequest)
+		return
+	case errors.Is(err, context.DeadlineExceeded):
+		app.gatewayTimeoutResponse(w, r, err)
+		return
+	}
+
 	app.logError(r, err)
 
 	message := "the server encountered a problem and could not process your request"
@@ -41,6 +87,16 @@ func (app *application) serverErrorResponse(w http.ResponseWriter, r *http.Reque
 
 }
 
+// The gatewayTimeoutResponse() method will be used to send a 504 Gateway Timeout status
+// code when a database query took longer than the -db-query-timeout limit. The error
+// is still logged, since slow queries are something we want to know about.
+func (app *application) gatewayTimeoutResponse(w http.ResponseWriter, r *http.Request, err error) {
+	app.logError(r, err)
+
+	message := "the database took too long to respond, please try again later"
+	app.errorResponse(w, r, http.StatusGatewayTimeout, message)
+}
+
 // The notFoundResponse() method will be used to send a 404 Not Found Status code and
 // JSON response to the client.
 func (app *application) notFoundResponse(w http.ResponseWriter, r *http.Request) {
@@ -55,6 +111,19 @@ func (app *application) methodNotAllowedResponse(w http.ResponseWriter, r *http.
 	app.errorResponse(w, r, http.StatusMethodNotAllowed, message)
 }
 
+// The notAcceptableResponse() method will be used to send a 406 Not Acceptable status
+// code when the client's Accept header doesn't allow any of the formats we can send
+// the response in. The message lists the ones we can.
+func (app *application) notAcceptableResponse(w http.ResponseWriter, r *http.Request, offers []*render.Format) {
+	supported := make([]string, len(offers))
+	for i, offer := range offers {
+		supported[i] = offer.MediaType
+	}
+
+	message := fmt.Sprintf("the requested representation is not available, supported types are: %s", strings.Join(supported, ", "))
+	app.errorResponse(w, r, http.StatusNotAcceptable, message)
+}
+
 func (app *application) badRequestResponse(w http.ResponseWriter, r *http.Request, err error) {
 	app.errorResponse(w, r, http.StatusBadRequest, err.Error())
 }
@@ -64,3 +133,65 @@ func (app *application) badRequestResponse(w http.ResponseWriter, r *http.Reques
 func (app *application) failedValidationResponse(w http.ResponseWriter, r *http.Request, errors map[string]string) {
 	app.errorResponse(w, r, http.StatusUnprocessableEntity, errors)
 }
+
+// The editConflictResponse() method will be used to send a 409 Conflict status code
+// when an update fails because the record was changed by another request.
+func (app *application) editConflictResponse(w http.ResponseWriter, r *http.Request) {
+	message := "unable to update the record due to an edit conflict, please try again"
+	app.errorResponse(w, r, http.StatusConflict, message)
+}
+
+// The preconditionFailedResponse() method will be used to send a 412 Precondition Failed
+// status code when the If-Match header doesn't match the current ETag of the resource.
+func (app *application) preconditionFailedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the resource has been modified since it was last fetched, please fetch it again"
+	app.errorResponse(w, r, http.StatusPreconditionFailed, message)
+}
+
+// The rateLimitExceededResponse() method will be used to send a 429 Too Many Requests
+// status code, with a Retry-After header telling the client how many seconds to wait.
+func (app *application) rateLimitExceededResponse(w http.ResponseWriter, r *http.Request, retryAfter string) {
+	w.Header().Set("Retry-After", retryAfter)
+
+	message := "rate limit exceeded"
+	app.errorResponse(w, r, http.StatusTooManyRequests, message)
+}
+
+// The invalidCredentialsResponse() method will be used to send a 401 Unauthorized
+// status code when the email and password provided by the client are incorrect.
+func (app *application) invalidCredentialsResponse(w http.ResponseWriter, r *http.Request) {
+	message := "invalid authentication credentials"
+	app.errorResponse(w, r, http.StatusUnauthorized, message)
+}
+
+// The invalidAuthenticationTokenResponse() method will be used to send a 401
+// Unauthorized status code when the bearer token is missing, malformed, expired or
+// unknown. The WWW-Authenticate header reminds the client how to authenticate.
+func (app *application) invalidAuthenticationTokenResponse(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("WWW-Authenticate", "Bearer")
+
+	message := "invalid or missing authentication token"
+	app.errorResponse(w, r, http.StatusUnauthorized, message)
+}
+
+// The authenticationRequiredResponse() method will be used to send a 401 Unauthorized
+// status code when an anonymous user tries to access an endpoint which requires
+// authentication.
+func (app *application) authenticationRequiredResponse(w http.ResponseWriter, r *http.Request) {
+	message := "you must be authenticated to access this resource"
+	app.errorResponse(w, r, http.StatusUnauthorized, message)
+}
+
+// The inactiveAccountResponse() method will be used to send a 403 Forbidden status code
+// when an authenticated user hasn't activated their account yet.
+func (app *application) inactiveAccountResponse(w http.ResponseWriter, r *http.Request) {
+	message := "your user account must be activated to access this resource"
+	app.errorResponse(w, r, http.StatusForbidden, message)
+}
+
+// The notPermittedResponse() method will be used to send a 403 Forbidden status code
+// when an activated user doesn't have the permission an endpoint requires.
+func (app *application) notPermittedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "your user account doesn't have the necessary permissions to access this resource"
+	app.errorResponse(w, r, http.StatusForbidden, message)
+}
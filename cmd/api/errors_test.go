@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"expvar"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"delsanchez.gl/internal/data"
+	"delsanchez.gl/internal/jsonlog"
+)
+
+// timeoutMovieStore is a MovieStore whose Get() fails the way MovieModel.Get() does
+// when the query runs out of time.
+type timeoutMovieStore struct {
+	data.MovieStore
+}
+
+func (timeoutMovieStore) Get(ctx context.Context, id int64) (*data.Movie, error) {
+	return nil, fmt.Errorf("%w: pq: canceling statement due to user request", context.DeadlineExceeded)
+}
+
+func TestQueryTimeout(t *testing.T) {
+	app := newTestApplication(t)
+	app.models.Movies = timeoutMovieStore{app.models.Movies}
+	ts := newTestServer(t, app)
+
+	res := ts.Get("/v1/movies/1", app.authHeader(t, "movies:read"))
+
+	res.AssertError(http.StatusGatewayTimeout, "the database took too long to respond, please try again later")
+}
+
+func TestClientCanceled(t *testing.T) {
+	var logs bytes.Buffer
+
+	app := newTestApplication(t)
+	app.logger = jsonlog.New(&logs, jsonlog.LevelDebug, jsonlog.FormatJSON)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	r := httptest.NewRequest(http.MethodGet, "/v1/movies/1", nil).WithContext(ctx)
+	rr := httptest.NewRecorder()
+
+	app.serverErrorResponse(rr, r, fmt.Errorf("%w: pq: canceling statement due to user request", context.Canceled))
+
+	if rr.Code != statusClientClosedRequest {
+		t.Errorf("got status %d; want %d", rr.Code, statusClientClosedRequest)
+	}
+	if rr.Body.Len() != 0 {
+		t.Errorf("got response body %q; want none", rr.Body)
+	}
+	if !strings.Contains(logs.String(), `"level":"DEBUG"`) {
+		t.Errorf("got log %q; want a DEBUG entry", logs.String())
+	}
+}
+
+// The metrics middleware must count a canceled request as a 499, rather than as the
+// 200 net/http would send if nothing was written.
+func TestClientCanceledMetrics(t *testing.T) {
+	app := newTestApplication(t)
+
+	handler := app.metrics(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithCancel(r.Context())
+		cancel()
+
+		app.serverErrorResponse(w, r.WithContext(ctx), fmt.Errorf("%w: pq: canceling statement due to user request", context.Canceled))
+	}))
+
+	count := func(status string) int64 {
+		if v := totalResponsesSentByStatus.Get(status); v != nil {
+			return v.(*expvar.Int).Value()
+		}
+		return 0
+	}
+
+	before499, before200 := count("499"), count("200")
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/v1/movies/1", nil))
+
+	if got := count("499") - before499; got != 1 {
+		t.Errorf("got %d more 499 responses in the metrics; want 1", got)
+	}
+	if got := count("200") - before200; got != 0 {
+		t.Errorf("got %d more 200 responses in the metrics; want 0", got)
+	}
+}
@@ -32,15 +32,24 @@ func (app *application) healthCheckHandler(w http.ResponseWriter, r *http.Reques
 	// Declare an envelope map containing the data for the response.
 	// The way I constructed this means the environment and version data will now
 	// be nested under a system_info key in the JSON response.
+	// ===============================================================================
+	// The system_info also includes the build details, so that we can tell exactly
+	// which build is running.
+	info := versionInfo()
+
 	env := envelope{
 		"status": "available",
-		"system_info": map[string]string{
+		"system_info": map[string]any{
 			"environment": app.config.env,
-			"version":     version,
+			"version":     info.Version,
+			"build_time":  info.BuildTime,
+			"revision":    info.Revision,
+			"commit_time": info.CommitTime,
+			"modified":    info.Modified,
 		},
 	}
 
-	err := app.writeJSON(w, http.StatusOK, env, nil)
+	err := app.writeResponse(w, r, http.StatusOK, env, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestHealthcheck(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app)
+
+	res := ts.Get("/v1/healthcheck", nil)
+
+	res.AssertStatus(http.StatusOK)
+
+	if got := res.Header.Get("Content-Type"); got != "application/json" {
+		t.Errorf("got Content-Type %q; want %q", got, "application/json")
+	}
+
+	// The build details depend on how the test binary was built.
+	res.AssertGolden("healthcheck", "version", "build_time", "revision", "commit_time", "modified")
+}
@@ -6,9 +6,13 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"slices"
 	"strconv"
 	"strings"
 
+	"delsanchez.gl/internal/render"
+	"delsanchez.gl/internal/validator"
 	"github.com/julienschmidt/httprouter"
 )
 
@@ -31,20 +35,62 @@ func (app *application) readIDParam(r *http.Request) (int64, error) {
 	return id, nil
 }
 
-// writeJSON helper for sending responses. This takes the destination
-// http.ResponseWriter, the HTTP status code to send, the data to encode to JSON,
+// movieETag() returns the entity tag for a movie. The version number is incremented
+// on every update, so it's enough to uniquely identify each revision of the record.
+func movieETag(version int32) string {
+	return fmt.Sprintf(`"%d"`, version)
+}
+
+// ifMatch() reports whether the If-Match header of the request allows a write to a
+// resource with the given ETag. A missing header or "*" always matches. Otherwise the
+// header is a comma-separated list of ETags, and per RFC 9110 we use the strong
+// comparison, so weak ETags (W/"...") never match.
+func (app *application) ifMatch(r *http.Request, etag string) bool {
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		return true
+	}
+
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// writeResponse helper for sending responses. This takes the destination
+// http.ResponseWriter, the request, the HTTP status code to send, the data to encode,
 // and a header map containing any additional HTTP headers we need to include in the response.
+// ===================================================================================
+// The data is encoded in the format that the negotiate() middleware chose from the
+// Accept header before the handler ran: JSON (the default), XML, CSV (only for lists)
+// or MessagePack. See the internal/render package. Responses sent without a chosen
+// format (like errors from the other middleware) and errors which the chosen format
+// can't encode (CSV) are negotiated here instead, and fall back to JSON rather than
+// being hidden by a 406.
 type envelope map[string]any
 
-func (app *application) writeJSON(w http.ResponseWriter, status int, data envelope, headers http.Header) error {
+func (app *application) writeResponse(w http.ResponseWriter, r *http.Request, status int, data envelope, headers http.Header) error {
+	// Write any movie runtimes in the style the client asked for.
+	data = app.styleRuntimes(r, data)
 
-	//Encode the data to JSON. returning an error if there was one.
-	js, err := json.MarshalIndent(data, "", "\t")
+	offers := render.Offers(data)
+
+	format, ok := app.contextGetFormat(r)
+	if !ok || !slices.Contains(offers, format) {
+		format, ok = render.Negotiate(r.Header.Get("Accept"), offers)
+		if !ok {
+			format = render.JSON
+		}
+	}
+
+	// Encode the data, returning an error if there was one.
+	body, err := format.Marshal(data)
 	if err != nil {
 		return err
 	}
-	// Append a new line to make it nice in the terminal
-	js = append(js, '\n')
 
 	// At this point, we know that we won't encounter any more errors before writing the response,
 	// so it's safe to add any headers that we want to include. We loop through the header map
@@ -53,11 +99,13 @@ func (app *application) writeJSON(w http.ResponseWriter, status int, data envelo
 	for key, value := range headers {
 		w.Header()[key] = value
 	}
-	// Add the "Content-Type": "application/json" header, then write the status code and
-	// json response.
-	w.Header().Set("Content-Type", "application/json")
+	// The response depends on the Accept header, so caches must take it into account.
+	// Then add the Content-Type header for the chosen format, and write the status code
+	// and the response body.
+	w.Header().Add("Vary", "Accept")
+	w.Header().Set("Content-Type", format.ContentType)
 	w.WriteHeader(status)
-	w.Write(js)
+	w.Write(body)
 
 	return nil
 }
@@ -145,13 +193,13 @@ func (app *application) readJSON(w http.ResponseWriter, r *http.Request, dst any
 			return fmt.Errorf("body contains incorrect JSON type (at character %d)", unmarshalTypeError.Offset)
 
 		case errors.Is(err, io.EOF):
-			return errors.New("body must be empty")
+			return errors.New("body must not be empty")
 		// If the JSON contains a field which cannot be mapped to the target
 		// destination, then Decode() will now return an error message in the format "json: unknown
 		// field "<name>"". We check for this, extract the field name from the error,
 		// and interpolate it into our custom error message.
-		case strings.HasPrefix(err.Error(), "json: unknown field"):
-			fieldName := strings.TrimPrefix(err.Error(), "json: unknown field")
+		case strings.HasPrefix(err.Error(), "json: unknown field "):
+			fieldName := strings.TrimPrefix(err.Error(), "json: unknown field ")
 			return fmt.Errorf("body contains unknown key %s", fieldName)
 
 		// Use the errors.As() function to check whether the error has the type
@@ -173,3 +221,68 @@ func (app *application) readJSON(w http.ResponseWriter, r *http.Request, dst any
 
 	return nil
 }
+
+// The readString() helper returns a string value from the query string, or the provided
+// default value if no matching key could be found.
+func (app *application) readString(qs url.Values, key string, defaultValue string) string {
+	s := qs.Get(key)
+
+	if s == "" {
+		return defaultValue
+	}
+
+	return s
+}
+
+// The readCSV() helper reads a string value from the query string and then splits it
+// into a slice on the comma character. If no matching key could be found, it returns
+// the provided default value.
+func (app *application) readCSV(qs url.Values, key string, defaultValue []string) []string {
+	csv := qs.Get(key)
+
+	if csv == "" {
+		return defaultValue
+	}
+
+	return strings.Split(csv, ",")
+}
+
+// The readInt() helper reads a string value from the query string and converts it to an
+// integer before returning. If no matching key could be found it returns the provided
+// default value. If the value couldn't be converted to an integer, then we record an
+// error message in the provided Validator instance.
+func (app *application) readInt(qs url.Values, key string, defaultValue int, v *validator.Validator) int {
+	s := qs.Get(key)
+
+	if s == "" {
+		return defaultValue
+	}
+
+	i, err := strconv.Atoi(s)
+	if err != nil {
+		v.AddError(key, "must be an integer value")
+		return defaultValue
+	}
+
+	return i
+}
+
+// The background() helper runs the given function in a new goroutine, and keeps track
+// of it in the application's WaitGroup so that graceful shutdown waits for it.
+// A panic in a goroutine can't be caught by the recoverPanic() middleware and would
+// crash the whole application, so we recover it here and log it instead.
+func (app *application) background(fn func()) {
+	app.wg.Add(1)
+
+	go func() {
+		defer app.wg.Done()
+
+		defer func() {
+			if err := recover(); err != nil {
+				app.logger.PrintError(fmt.Errorf("panic: %v", err), nil)
+			}
+		}()
+
+		fn()
+	}()
+}
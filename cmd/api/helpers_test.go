@@ -0,0 +1,111 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// The readJSON() error branches are tested through POST /v1/movies, so that we also
+// check they come back to the client as 400 Bad Request responses.
+func TestReadJSON(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app)
+
+	writer := app.authHeader(t, "movies:write")
+
+	tests := []struct {
+		name        string
+		body        string
+		wantMessage string
+	}{
+		{
+			name:        "Badly-formed JSON",
+			body:        `{"title": "Moana", }`,
+			wantMessage: "body contains badly-formed JSON (at character 20)",
+		},
+		{
+			name:        "Unexpected EOF",
+			body:        `{"title": "Moana"`,
+			wantMessage: "body contains badly-formed JSON",
+		},
+		{
+			name:        "Incorrect type for field",
+			body:        `{"title": 123}`,
+			wantMessage: `body contains incorrect JSON type for field "title"`,
+		},
+		{
+			name:        "Incorrect type",
+			body:        `["foo", "bar"]`,
+			wantMessage: "body contains incorrect JSON type (at character 1)",
+		},
+		{
+			name:        "Empty body",
+			body:        ``,
+			wantMessage: "body must not be empty",
+		},
+		{
+			name:        "Unknown key",
+			body:        `{"title": "Moana", "rating": "PG"}`,
+			wantMessage: `body contains unknown key "rating"`,
+		},
+		{
+			name:        "Too large",
+			body:        `{"title": "` + strings.Repeat("a", 1_048_576) + `"}`,
+			wantMessage: "body must not be larger than 1048576 bytes",
+		},
+		{
+			name:        "Multiple JSON values",
+			body:        `{"title": "Moana"}{"title": "Frozen"}`,
+			wantMessage: "body must only contain a single JSON value",
+		},
+		{
+			name:        "Invalid runtime",
+			body:        `{"runtime": "107 minutes and a bit"}`,
+			wantMessage: "invalid runtime format",
+		},
+		{
+			name:        "Negative runtime",
+			body:        `{"runtime": "-1 mins"}`,
+			wantMessage: "runtime must not be negative",
+		},
+		{
+			name:        "Overflowing runtime",
+			body:        `{"runtime": 2147483648}`,
+			wantMessage: "runtime must not be more than 2147483647 mins",
+		},
+		{
+			name:        "Fractional runtime",
+			body:        `{"runtime": "1h42m30s"}`,
+			wantMessage: "runtime must be a whole number of minutes",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := ts.Do(http.MethodPost, "/v1/movies", tt.body, writer)
+
+			res.AssertError(http.StatusBadRequest, tt.wantMessage)
+		})
+	}
+}
+
+// Passing something other than a non-nil pointer to readJSON() is a bug in our code,
+// so it panics instead of returning an error.
+func TestReadJSONInvalidDestination(t *testing.T) {
+	app := newTestApplication(t)
+
+	defer func() {
+		if recover() == nil {
+			t.Error("readJSON() did not panic")
+		}
+	}()
+
+	var dst struct{ Title string }
+
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"Title": "Moana"}`))
+	w := httptest.NewRecorder()
+
+	app.readJSON(w, r, dst)
+}
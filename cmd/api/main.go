@@ -3,19 +3,32 @@ package main
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"expvar"
 	"flag"
 	"fmt"
-	"log"
-	"net/http"
 	"os"
+	"runtime"
+	"sync"
 	"time"
 
+	"delsanchez.gl/internal/data"
+	"delsanchez.gl/internal/jsonlog"
+	"delsanchez.gl/internal/mailer"
 	_ "github.com/lib/pq"
 )
 
-// A string containing the application version number. Later,
-// this number will be generated automatically at build time.
-const version = "1.0.0"
+// The application version number and the time the binary was built. These are set
+// at build time with the linker, e.g.
+//
+//	go build -ldflags="-X main.version=1.2.0 -X main.buildTime=2024-05-01T10:00:00Z" ./cmd/api
+//
+// (see the Makefile). If they weren't, versionInfo() falls back to the information
+// the Go toolchain stamps into the binary.
+var (
+	version   string
+	buildTime string
+)
 
 // A config struct that will hold all the configuration settings of the application.
 // For now, the configuration setting will be the network port that we want the server
@@ -27,88 +40,245 @@ const version = "1.0.0"
 // ===================================================================================
 // Added maxOpenConns, maxIdleConns,maxIdleTime fields to hold the configuration settings
 // for the connection pool.
+// ===================================================================================
+// Added an autoMigrate field which tells the application to apply any pending
+// schema migrations at startup.
+// ===================================================================================
+// Added a queryTimeout field to the db struct, the time limit for each database query.
+// ===================================================================================
+// Added shutdownTimeout, the grace period in-flight requests get to complete when
+// the server is shutting down.
+// ===================================================================================
+// Added a log struct to hold the minimum log level and the output format (text|json).
+// ===================================================================================
+// Added a limiter struct containing the requests-per-second and burst values for the
+// rate limiter, and a boolean which can be used to disable rate limiting altogether.
+// ===================================================================================
+// Added a compress struct to enable or disable response compression, and to hold the
+// minimum size of the responses which get compressed.
+// ===================================================================================
+// Added a metrics struct with a boolean which exposes the expvar metrics at
+// GET /debug/vars. It's off by default, as the metrics aren't meant to be public.
+// ===================================================================================
+// Added a smtp struct to hold the SMTP server settings for the mailer.
+// ===================================================================================
+// Added a cors struct holding the list of origins which are trusted to make
+// cross-origin requests.
+// ===================================================================================
+// Added a file field holding the path of the (optional) JSON config file.
+// ===================================================================================
+// Added displayVersion, which is set by the -version flag.
+// ===================================================================================
+// Added storage, which selects where the data is kept (memory|postgres).
 type config struct {
-	port int
-	env  string
-	db   struct {
+	file            string
+	displayVersion  bool
+	storage         string
+	port            int
+	env             string
+	shutdownTimeout time.Duration
+	log             struct {
+		level  string
+		format string
+	}
+	db struct {
 		dsn          string
 		maxOpenConns int
 		maxIdleConns int
 		maxIdleTime  string
+		queryTimeout time.Duration
+		autoMigrate  bool
+	}
+	limiter struct {
+		rps     float64
+		burst   int
+		enabled bool
+	}
+	compress struct {
+		enabled bool
+		minSize int
+	}
+	metrics struct {
+		enabled bool
+	}
+	smtp struct {
+		host     string
+		port     int
+		username string
+		password string
+		sender   string
+	}
+	cors struct {
+		trustedOrigins []string
 	}
 }
 
 // This application struct will hold the dependencies for the HTTP handlers,
 // helpers, and middlewares. For now, its only the config struct and logger,
 // but this will grow overtime as the project matures.
-
+// ===================================================================================
+// Added a models field to hold the data.Models struct, so that the handlers can
+// reach the database through it.
+// ===================================================================================
+// Added a sync.WaitGroup to keep track of the goroutines started with app.background(),
+// so that we can wait for them to finish before the application exits.
+// ===================================================================================
+// Changed the logger field to a *jsonlog.Logger, which writes leveled, structured
+// log entries.
+// ===================================================================================
+// Added a mailer field for sending emails (like the welcome email) to users.
+// ===================================================================================
+// Added rateLimitClients, the per-client state of the rateLimit() middleware.
 type application struct {
-	config config
-	logger *log.Logger
+	config           config
+	logger           *jsonlog.Logger
+	models           data.Models
+	mailer           mailer.Mailer
+	wg               sync.WaitGroup
+	rateLimitClients rateLimitClients
 }
 
 func main() {
 
-	// Declaring an instance of config struct
-	var cfg config
+	// Load the configuration from the command-line flags, GREENLIGHT_* environment
+	// variables and the optional config file (see config.go for the precedence), and
+	// validate it. We don't have a logger yet at this point, so any problems are
+	// reported on stderr.
+	cfg, err := loadConfig(flag.CommandLine, os.Args[1:], os.Getenv)
 
-	// Read the value of the port and env command-line flag into the config struct.
-	// default is using 4000 and the enviroment "development" if no
-	// correspanding flags are provided.
+	// If the -version flag was given, print the build details and exit.
+	if cfg.displayVersion {
+		printVersion(os.Stdout)
+		return
+	}
+
+	// The `config print` subcommand prints the effective configuration, and is
+	// useful precisely when the configuration is wrong, so handle it before bailing
+	// out on a validation error.
+	if flag.Arg(0) == "config" {
+		if printErr := runConfig(flag.CommandLine, flag.Args()[1:], os.Stdout); printErr != nil {
+			fmt.Fprintln(os.Stderr, printErr)
+			os.Exit(2)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
 
-	flag.IntVar(&cfg.port, "port", 4000, "API server port")
-	flag.StringVar(&cfg.env, "env", "development", "Environment (development|staging|production)")
-	// Read the DSN value from the db-dsn command-line flag into the config struct.
-	// Default is development DSN if no flag is provided.
-	flag.StringVar(&cfg.db.dsn, "db-dsn", os.Getenv("GREENLIGHT_DB_DSN"), "PostgreSQL DSN")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
 
-	// Read the connection pool settings from the command-line flags into the config struct.main
-	// Note the default values I'm using.
-	flag.IntVar(&cfg.db.maxOpenConns, "db-max-open-conns", 25, "PostgreSQL max open connections")
-	flag.IntVar(&cfg.db.maxIdleConns, "db-max-idle-conns", 25, "PostgreSQL max idle connections")
-	flag.StringVar(&cfg.db.maxIdleTime, "db-max-idle-time", "15m", "PostgreSQL max connection idle time")
-	flag.Parse()
+	// Initialize a new jsonlog.Logger which writes any messages *at or above* the
+	// minimum severity level to the standard out stream, in the requested format.
+	// The level and format have already been validated by loadConfig().
+	logLevel, _ := jsonlog.ParseLevel(cfg.log.level)
+	logFormat, _ := jsonlog.ParseFormat(cfg.log.format)
 
-	// Initialize a new logger which writes a message to stdout stream.
-	// prefixed with the current date and time.
+	logger := jsonlog.New(os.Stdout, logLevel, logFormat)
 
-	logger := log.New(os.Stdout, "", log.Ldate|log.Ltime)
+	// With the memory storage backend there's no database at all, and the data only
+	// lives as long as the process. Otherwise, call the openDB() helper function to
+	// create the connection pool passing in the config struct. If this returns an
+	// error, log it and exit the application immediately.
+	var (
+		db     *sql.DB
+		models data.Models
+	)
 
-	// Call the openDB() helper function to create the connection pool
-	// passing in the config struct,. If this returns an error, log it and
-	// exit the application immediately.
-	db, err := openDB(cfg)
-	if err != nil {
-		logger.Fatal(err)
+	switch cfg.storage {
+	case "memory":
+		models = data.NewMemoryModels()
+		logger.PrintInfo("using in-memory storage, all data will be lost on shutdown", nil)
+	default:
+		db, err = openDB(cfg)
+		if err != nil {
+			logger.PrintFatal(err, nil)
+		}
+		// Defer a call to db.Close() so that the connection pool is closed
+		// before the main() function exits.
+		defer db.Close()
+
+		// if there are no errors above, log a message to say that
+		// the connection pool has been successfully established.
+		logger.PrintInfo("database connection pool established", nil)
+
+		models = data.NewModels(db, cfg.db.queryTimeout)
+	}
+
+	// Publish the application version, the number of active goroutines, the live
+	// connection pool statistics (when there is a pool) and the current Unix
+	// timestamp in the expvar handler. expvar.Func values are evaluated every time
+	// /debug/vars is requested.
+	expvar.NewString("version").Set(versionInfo().Version)
+
+	expvar.Publish("goroutines", expvar.Func(func() any {
+		return runtime.NumGoroutine()
+	}))
+
+	if db != nil {
+		expvar.Publish("database", expvar.Func(func() any {
+			return db.Stats()
+		}))
 	}
-	// Defer a call to db.Close() so that the connection pool is closed
-	// before the main() function exits.
-	defer db.Close()
 
-	// if there are no errors above, log a message to say that
-	// the connection pool has been successfully established.
-	logger.Printf("database connection pool has been established.")
+	expvar.Publish("timestamp", expvar.Func(func() any {
+		return time.Now().Unix()
+	}))
 
-	// Instance of application struct containing config struct and the logger.
+	// Any other non-flag arguments are treated as a subcommand. Apart from `config`
+	// (handled above) the only one is `migrate`, which runs the embedded schema
+	// migrations and exits, e.g. `api -db-dsn=... migrate up`.
+	if flag.NArg() > 0 {
+		if flag.Arg(0) != "migrate" {
+			logger.PrintFatal(fmt.Errorf("unknown command %q", flag.Arg(0)), nil)
+		}
+		if db == nil {
+			logger.PrintFatal(errors.New("the migrate command needs -storage=postgres"), nil)
+		}
+		err = runMigrate(db, flag.Args()[1:], os.Stdout)
+		if err != nil {
+			logger.PrintFatal(err, nil)
+		}
+		return
+	}
+
+	// Instance of application struct containing config struct, the logger and the
+	// models for the selected storage backend.
 	app := &application{
 		config: cfg,
 		logger: logger,
+		models: models,
+		mailer: newMailer(cfg, logger),
+	}
+
+	// If the -db-auto-migrate flag was set, bring the database schema up to date
+	// before we start accepting requests.
+	if cfg.db.autoMigrate && db != nil {
+		err = app.autoMigrate(db)
+		if err != nil {
+			logger.PrintFatal(err, nil)
+		}
+	}
+
+	// Call app.serve() to start the server. It only returns once the server has been
+	// shut down, either gracefully (nil) or because of a real failure. In the failure
+	// case we close the connection pool ourselves before exiting with a non-zero exit
+	// code, because logger.PrintFatal() doesn't run deferred functions.
+	err = app.serve()
+	if err != nil {
+		if db != nil {
+			db.Close()
+		}
+		logger.PrintFatal(err, nil)
 	}
 
-	// Declare a HTTP server with sensible timeout settings, which listens on the port
-	// provided in the config struct and use the servemux created above as the handler.
-	srv := &http.Server{
-		Addr: fmt.Sprintf(":%d", cfg.port),
-		// Using the httprouter instance returned by app.routes() as the server handler
-		Handler:      app.routes(),
-		IdleTimeout:  time.Minute,
-		ReadTimeout:  10 * time.Second,
-		WriteTimeout: 30 * time.Second,
-	}
-	// This will start the HTTP server.
-	logger.Printf("starting %s server on %s", cfg.env, srv.Addr)
-	err = srv.ListenAndServe()
-	logger.Fatal(err)
+	if db != nil {
+		logger.PrintInfo("closing database connection pool", nil)
+	}
 }
 
 func openDB(cfg config) (*sql.DB, error) {
@@ -150,3 +320,15 @@ func openDB(cfg config) (*sql.DB, error) {
 	}
 	return db, nil
 }
+
+// newMailer() returns an SMTP mailer if an SMTP host was configured, or otherwise an
+// in-memory mailer which keeps the messages instead of sending them. That's handy in
+// development, where there usually isn't an SMTP server to hand.
+func newMailer(cfg config, logger *jsonlog.Logger) mailer.Mailer {
+	if cfg.smtp.host == "" {
+		logger.PrintInfo("no SMTP host configured, emails will be captured in memory", nil)
+		return mailer.NewMemory()
+	}
+
+	return mailer.NewSMTP(cfg.smtp.host, cfg.smtp.port, cfg.smtp.username, cfg.smtp.password, cfg.smtp.sender)
+}
@@ -0,0 +1,897 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"expvar"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"delsanchez.gl/internal/data"
+	"delsanchez.gl/internal/render"
+	"delsanchez.gl/internal/validator"
+	"github.com/andybalholm/brotli"
+	"github.com/julienschmidt/httprouter"
+	"golang.org/x/time/rate"
+)
+
+// The requestID() middleware gives every request an ID, which is stored in the request
+// context, echoed in the X-Request-ID response header, and included in error log
+// entries and error responses. If the client (or a proxy in front of us) sent an
+// X-Request-ID header we keep using that ID, so that it can be followed from one
+// system to the next, as long as it's a reasonable length and free of spaces and
+// control characters (we don't want it to mangle the logs). Otherwise, we generate a
+// random one.
+func (app *application) requestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+
+		if !validRequestID(id) {
+			randomBytes := make([]byte, 16)
+			_, err := rand.Read(randomBytes)
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+			id = hex.EncodeToString(randomBytes)
+		}
+
+		w.Header().Set("X-Request-ID", id)
+
+		next.ServeHTTP(w, app.contextSetRequestID(r, id))
+	})
+}
+
+// validRequestID() reports whether an incoming request ID can be used as it is: at
+// most 128 characters of printable ASCII, excluding spaces.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+
+	for i := 0; i < len(id); i++ {
+		if id[i] < '!' || id[i] > '~' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// The negotiate() middleware chooses the format of the response from the Accept header,
+// among the given offers (see the internal/render package), and stores it in the
+// request context for writeResponse(). It runs before the handler, so that a client
+// which doesn't accept any of the formats gets a 406 Not Acceptable response before
+// the handler changes anything. Only the routes which respond with a list offer CSV.
+func (app *application) negotiate(offers []*render.Format, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		format, ok := render.Negotiate(r.Header.Get("Accept"), offers)
+		if !ok {
+			app.notAcceptableResponse(w, r, offers)
+			return
+		}
+
+		next.ServeHTTP(w, app.contextSetFormat(r, format))
+	}
+}
+
+// The runtimeStyle() middleware reads the optional runtime_style query string
+// parameter, which selects how movie runtimes are written in the response (see
+// data.RuntimeStyle), and stores it in the request context for writeResponse(). It's
+// checked here, before the handler runs, so that a request with an invalid style is
+// rejected before it changes anything. It's only used on the routes which respond with
+// movies, so the parameter means nothing (and isn't checked) anywhere else.
+func (app *application) runtimeStyle(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := r.URL.Query().Get("runtime_style")
+		if name == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		style, err := data.ParseRuntimeStyle(name)
+		if err != nil {
+			app.failedValidationResponse(w, r, map[string]string{
+				"runtime_style": "must be one of " + strings.Join(data.RuntimeStyleNames(), "|"),
+			})
+			return
+		}
+
+		next.ServeHTTP(w, app.contextSetRuntimeStyle(r, style))
+	}
+}
+
+// Unlike http.ServeMux, httprouter doesn't send HEAD requests to the GET handler of a
+// route, so without the headAsGet() middleware they get a 405 Method Not Allowed. A
+// HEAD request for a route which has a GET handler (and no HEAD handler of its own) is
+// passed on to the router as a GET request. The handler doesn't need to know: net/http
+// looks at the original request, and drops the body of the response to a HEAD request.
+func (app *application) headAsGet(router *httprouter.Router) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			head, _, _ := router.Lookup(http.MethodHead, r.URL.Path)
+			get, _, _ := router.Lookup(http.MethodGet, r.URL.Path)
+
+			if head == nil && get != nil {
+				r = r.Clone(r.Context())
+				r.Method = http.MethodGet
+			}
+		}
+
+		router.ServeHTTP(w, r)
+	})
+}
+
+// The recoverPanic() middleware recovers any panic in the handler chain (such as the
+// one readJSON() raises for a json.InvalidUnmarshalError) and sends the client a
+// proper JSON 500 Internal Server Error response, instead of net/http's default of
+// dropping the connection. It wraps the whole middleware chain, so that panics in the
+// other middleware (and in the response writers they install) are recovered too.
+func (app *application) recoverPanic(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Create a deferred function (which will always be run in the event of a panic
+		// as Go unwinds the stack).
+		defer func() {
+			// Use the builtin recover function to check if there has been a panic or not.
+			if err := recover(); err != nil {
+				// http.ErrAbortHandler is used deliberately to abort a response, and
+				// net/http knows to handle it quietly, so let it carry on up.
+				if err == http.ErrAbortHandler {
+					panic(err)
+				}
+
+				// If there was a panic, set a "Connection: close" header on the
+				// response. This acts as a trigger to make Go's HTTP server
+				// automatically close the current connection after a response has been
+				// sent.
+				w.Header().Set("Connection", "close")
+
+				// The requestID() middleware runs inside this one, so the request ID
+				// isn't in the context of r, but it has already been set on the
+				// response. Put it back so that it's in the log entry and the body.
+				if id := w.Header().Get("X-Request-ID"); id != "" {
+					r = app.contextSetRequestID(r, id)
+				}
+
+				// The value returned by recover() has the type any, so we use
+				// fmt.Errorf() to normalize it into an error and call our
+				// serverErrorResponse() helper. This logs the error (along with the
+				// stack trace, which still includes the panicking frames at this point)
+				// using our logger at the ERROR level and sends the client a 500
+				// Internal Server Error response.
+				app.serverErrorResponse(w, r, fmt.Errorf("panic: %v", err))
+			}
+		}()
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// A rateLimitClient holds the rate limiter and last seen time for a client.
+type rateLimitClient struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// rateLimitClients holds the rate limiters of the clients that the rateLimit()
+// middleware has seen, keyed by IP address. It lives on the application, rather than
+// inside the middleware, so that the sweeper started by serve() can remove the old
+// entries and stop when the server does. The zero value is ready to use.
+type rateLimitClients struct {
+	mu      sync.Mutex
+	clients map[string]*rateLimitClient
+}
+
+// sweep() removes the clients which haven't been seen within maxIdle.
+func (c *rateLimitClients) sweep(maxIdle time.Duration) {
+	// Lock the mutex to prevent any rate limiter checks from happening while the
+	// cleanup is taking place.
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for ip, client := range c.clients {
+		if time.Since(client.lastSeen) > maxIdle {
+			delete(c.clients, ip)
+		}
+	}
+}
+
+// sweepRateLimitClients() removes old entries from the rate limiter's clients map once
+// every minute, so that the map doesn't grow forever, until done is closed.
+func (app *application) sweepRateLimitClients(done <-chan struct{}) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			app.rateLimitClients.sweep(3 * time.Minute)
+		}
+	}
+}
+
+// The rateLimit() middleware limits each client (identified by IP address) to an average
+// of -limiter-rps requests per second, with bursts of up to -limiter-burst requests,
+// using a token-bucket rate limiter per client.
+func (app *application) rateLimit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Only carry out the check if rate limiting is enabled.
+		if !app.config.limiter.enabled {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Extract the client's IP address from the request.
+		ip, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		clients := &app.rateLimitClients
+		clients.mu.Lock()
+
+		// Check to see if the IP address already exists in the map. If it doesn't, then
+		// initialize a new rate limiter and add the IP address and limiter to the map.
+		if clients.clients == nil {
+			clients.clients = make(map[string]*rateLimitClient)
+		}
+		client, found := clients.clients[ip]
+		if !found {
+			client = &rateLimitClient{
+				limiter: rate.NewLimiter(rate.Limit(app.config.limiter.rps), app.config.limiter.burst),
+			}
+			clients.clients[ip] = client
+		}
+
+		// Update the last seen time for the client.
+		client.lastSeen = time.Now()
+
+		// Reserve a token for this request. If the token isn't available right away,
+		// cancel the reservation (handing the token back) and reject the request,
+		// telling the client how long it needs to wait in the Retry-After header.
+		reservation := client.limiter.Reserve()
+		if delay := reservation.Delay(); !reservation.OK() || delay > 0 {
+			reservation.Cancel()
+			clients.mu.Unlock()
+
+			retryAfter := 1
+			if reservation.OK() {
+				retryAfter = max(retryAfter, int(math.Ceil(delay.Seconds())))
+			}
+			app.rateLimitExceededResponse(w, r, strconv.Itoa(retryAfter))
+			return
+		}
+
+		// Very importantly, unlock the mutex before calling the next handler in the
+		// chain. Notice that we DON'T use defer to unlock the mutex, as that would mean
+		// that the mutex isn't unlocked until all the handlers downstream of this
+		// middleware have also returned.
+		clients.mu.Unlock()
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// The authenticate() middleware reads the bearer token from the Authorization header
+// and adds the matching user to the request context. Requests without an
+// Authorization header are treated as coming from the AnonymousUser.
+func (app *application) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Add the "Vary: Authorization" header to the response. This indicates to any
+		// caches that the response may vary based on the value of the Authorization
+		// header in the request.
+		w.Header().Add("Vary", "Authorization")
+
+		// Retrieve the value of the Authorization header from the request. This will
+		// return the empty string "" if there is no such header found.
+		authorizationHeader := r.Header.Get("Authorization")
+
+		// If there is no Authorization header found, use the contextSetUser() helper
+		// to add the AnonymousUser to the request context. Then we call the next
+		// handler in the chain and return without executing any of the code below.
+		if authorizationHeader == "" {
+			r = app.contextSetUser(r, data.AnonymousUser)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Otherwise, we expect the value of the Authorization header to be in the
+		// format "Bearer <token>". We try to split this into its constituent parts,
+		// and if the header isn't in the expected format we return a 401 Unauthorized
+		// response using the invalidAuthenticationTokenResponse() helper.
+		headerParts := strings.Split(authorizationHeader, " ")
+		if len(headerParts) != 2 || headerParts[0] != "Bearer" {
+			app.invalidAuthenticationTokenResponse(w, r)
+			return
+		}
+
+		// Extract the actual authentication token from the header parts.
+		token := headerParts[1]
+
+		// Validate the token to make sure it is in a sensible format.
+		v := validator.New()
+
+		if data.ValidateTokenPlaintext(v, token); !v.Valid() {
+			app.invalidAuthenticationTokenResponse(w, r)
+			return
+		}
+
+		// Retrieve the details of the user associated with the authentication token,
+		// again calling the invalidAuthenticationTokenResponse() helper if no matching
+		// record was found.
+		user, err := app.models.Users.GetForToken(r.Context(), data.ScopeAuthentication, token)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				app.invalidAuthenticationTokenResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		// Call the contextSetUser() helper to add the user information to the request
+		// context.
+		r = app.contextSetUser(r, user)
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// The requireAuthenticatedUser() middleware checks that a user is not anonymous.
+func (app *application) requireAuthenticatedUser(next http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := app.contextGetUser(r)
+
+		if user.IsAnonymous() {
+			app.authenticationRequiredResponse(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// The requireActivatedUser() middleware checks that a user is both authenticated and
+// activated.
+func (app *application) requireActivatedUser(next http.HandlerFunc) http.HandlerFunc {
+	// Rather than returning this http.HandlerFunc we assign it to the variable fn.
+	fn := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := app.contextGetUser(r)
+
+		// Check that a user is activated.
+		if !user.Activated {
+			app.inactiveAccountResponse(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+
+	// Wrap fn with the requireAuthenticatedUser() middleware before returning it.
+	return app.requireAuthenticatedUser(fn)
+}
+
+// The requirePermission() middleware checks that the (authenticated and activated)
+// user has the given permission code. The first parameter is the permission code that
+// we require the user to have.
+func (app *application) requirePermission(code string, next http.HandlerFunc) http.HandlerFunc {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		// Retrieve the user from the request context.
+		user := app.contextGetUser(r)
+
+		// Get the slice of permissions for the user.
+		permissions, err := app.models.Permissions.GetAllForUser(r.Context(), user.ID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		// Check if the slice includes the required permission. If it doesn't, then
+		// return a 403 Forbidden response.
+		if !permissions.Include(code) {
+			app.notPermittedResponse(w, r)
+			return
+		}
+
+		// Otherwise they have the required permission so we call the next handler in
+		// the chain.
+		next.ServeHTTP(w, r)
+	}
+
+	// Wrap this with the requireActivatedUser() middleware before returning it.
+	return app.requireActivatedUser(fn)
+}
+
+// The enableCORS() middleware allows cross-origin requests from the origins listed in
+// -cors-trusted-origins. It also answers CORS preflight requests itself, so they never
+// reach the router (which would otherwise send a 405 Method Not Allowed response for
+// OPTIONS requests).
+func (app *application) enableCORS(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Add the "Vary: Origin" header. The response is different depending on the
+		// Origin of the request, so any caches need to know that.
+		w.Header().Add("Vary", "Origin")
+
+		// Add the "Vary: Access-Control-Request-Method" header too, since preflight
+		// responses depend on it.
+		w.Header().Add("Vary", "Access-Control-Request-Method")
+
+		// Get the value of the request's Origin header.
+		origin := r.Header.Get("Origin")
+
+		// Only run this if there's an Origin request header present.
+		if origin != "" {
+			// Loop through the list of trusted origins, checking to see if the request
+			// origin exactly matches one of them. If there are no trusted origins, then
+			// the loop won't be iterated.
+			for i := range app.config.cors.trustedOrigins {
+				if origin == app.config.cors.trustedOrigins[i] {
+					// If there is a match, then set a "Access-Control-Allow-Origin"
+					// response header with the request origin as the value, and let
+					// the browser read the headers clients need for conditional
+					// requests and newly-created resources.
+					w.Header().Set("Access-Control-Allow-Origin", origin)
+					w.Header().Set("Access-Control-Expose-Headers", "ETag, Location, Retry-After, X-Request-ID")
+
+					// Check if the request has the HTTP method OPTIONS and contains the
+					// "Access-Control-Request-Method" header. If it does, then we treat
+					// it as a preflight request.
+					if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+						// Set the necessary preflight response headers.
+						w.Header().Set("Access-Control-Allow-Methods", "OPTIONS, PUT, PATCH, DELETE")
+						w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, If-Match, X-Request-ID")
+
+						// Write the headers along with a 200 OK status and return from
+						// the middleware with no further action.
+						w.WriteHeader(http.StatusOK)
+						return
+					}
+
+					break
+				}
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// The expvar variables for the metrics() middleware. expvar names are global and
+// registering the same one twice panics, so these live at the package level rather
+// than inside metrics() (which runs every time routes() is called).
+var (
+	totalRequestsReceived           = expvar.NewInt("total_requests_received")
+	totalResponsesSent              = expvar.NewInt("total_responses_sent")
+	totalProcessingTimeMicroseconds = expvar.NewInt("total_processing_time_μs")
+	totalResponsesSentByStatus      = expvar.NewMap("total_responses_sent_by_status")
+	inFlightRequests                = expvar.NewInt("in_flight_requests")
+)
+
+// The metricsResponseWriter type wraps an existing http.ResponseWriter and also
+// contains a field for recording the response status code, and a boolean flag to
+// indicate whether the response headers have already been written.
+type metricsResponseWriter struct {
+	wrapped       http.ResponseWriter
+	statusCode    int
+	headerWritten bool
+}
+
+// This function returns a new metricsResponseWriter instance which wraps a given
+// http.ResponseWriter and has a status code of 200 (which is the status code that Go
+// will send in a HTTP response by default).
+func newMetricsResponseWriter(w http.ResponseWriter) *metricsResponseWriter {
+	return &metricsResponseWriter{
+		wrapped:    w,
+		statusCode: http.StatusOK,
+	}
+}
+
+// The Header() method is a simple 'pass through' to the Header() method of the
+// wrapped http.ResponseWriter.
+func (mw *metricsResponseWriter) Header() http.Header {
+	return mw.wrapped.Header()
+}
+
+// Again, the WriteHeader() method does a 'pass through' to the WriteHeader() method of
+// the wrapped http.ResponseWriter. But after this returns, we also record the response
+// status code (if it hasn't already been recorded) and set the headerWritten field to
+// true to indicate that the HTTP response headers have now been written.
+func (mw *metricsResponseWriter) WriteHeader(statusCode int) {
+	mw.wrapped.WriteHeader(statusCode)
+
+	if !mw.headerWritten {
+		mw.statusCode = statusCode
+		mw.headerWritten = true
+	}
+}
+
+// Likewise the Write() method does a 'pass through' to the Write() method of the
+// wrapped http.ResponseWriter. Calling this will automatically write any response
+// headers, so we set the headerWritten field to true.
+func (mw *metricsResponseWriter) Write(b []byte) (int, error) {
+	mw.headerWritten = true
+	return mw.wrapped.Write(b)
+}
+
+// Flush() and Hijack() pass through to the wrapped http.ResponseWriter, so that
+// handlers which type-assert the writer to http.Flusher or http.Hijacker keep working.
+func (mw *metricsResponseWriter) Flush() {
+	if f, ok := mw.wrapped.(http.Flusher); ok {
+		mw.headerWritten = true
+		f.Flush()
+	}
+}
+
+func (mw *metricsResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := mw.wrapped.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("%T does not implement http.Hijacker", mw.wrapped)
+	}
+	return h.Hijack()
+}
+
+// We also need an Unwrap() method which returns the existing wrapped
+// http.ResponseWriter, for the benefit of http.ResponseController.
+func (mw *metricsResponseWriter) Unwrap() http.ResponseWriter {
+	return mw.wrapped
+}
+
+// The metrics() middleware records the request count, response count, processing time,
+// responses by status code and the number of in-flight requests, which are all exposed
+// at GET /debug/vars.
+func (app *application) metrics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Record the time that we started to process the request.
+		start := time.Now()
+
+		// Use the Add() method to increment the number of requests received by 1, and
+		// the number of in-flight requests for as long as the request is processed.
+		totalRequestsReceived.Add(1)
+		inFlightRequests.Add(1)
+		defer inFlightRequests.Add(-1)
+
+		// Create a new metricsResponseWriter, which wraps the original
+		// http.ResponseWriter value that the metrics middleware received.
+		mw := newMetricsResponseWriter(w)
+
+		// Record the response on the way back up the middleware chain. This is done in
+		// a deferred function so that it happens even if the handler panics. The panic
+		// carries on up to the recoverPanic() middleware, which sends a 500 response,
+		// so that's what we count it as.
+		completed := false
+		defer func() {
+			if !completed {
+				mw.statusCode = http.StatusInternalServerError
+			}
+
+			// Increment the number of responses sent by 1.
+			totalResponsesSent.Add(1)
+
+			// At this point, the response status code should be stored in the
+			// mw.statusCode field. Note that the expvar map is string-keyed, so we
+			// need to use the strconv.Itoa() function to convert the status code
+			// (which is an integer) to a string. Then we use the Add() method on our
+			// new totalResponsesSentByStatus map to increment the count for the given
+			// status code by 1.
+			totalResponsesSentByStatus.Add(strconv.Itoa(mw.statusCode), 1)
+
+			// Calculate the number of microseconds since we began to process the
+			// request, then increment the total processing time by this amount.
+			duration := time.Since(start).Microseconds()
+			totalProcessingTimeMicroseconds.Add(duration)
+		}()
+
+		// Call the next handler in the chain using the new metricsResponseWriter as
+		// the http.ResponseWriter value.
+		next.ServeHTTP(mw, r)
+		completed = true
+	})
+}
+
+// The content codings the compress() middleware supports, in order of preference.
+// Brotli compresses JSON noticeably better than gzip, so it wins a tie.
+var compressEncodings = []string{"br", "gzip"}
+
+// compressor is implemented by both *gzip.Writer and *brotli.Writer.
+type compressor interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+// Creating a compressor allocates a lot of memory (especially for brotli), so they're
+// pooled and reused across requests.
+var compressorPools = map[string]*sync.Pool{
+	"br": {New: func() any {
+		return brotli.NewWriterLevel(nil, brotli.DefaultCompression)
+	}},
+	"gzip": {New: func() any {
+		return gzip.NewWriter(nil)
+	}},
+}
+
+// Content types which are already compressed, and don't get any smaller by
+// compressing them again. Entries ending with "/" match the whole top-level type.
+var incompressibleTypes = []string{
+	"image/", "audio/", "video/",
+	"application/gzip", "application/x-gzip", "application/zip", "application/zstd",
+	"application/x-brotli", "application/x-7z-compressed", "application/x-rar-compressed",
+	"font/woff", "font/woff2",
+}
+
+// acceptEncoding() returns the content coding to compress the response with, given the
+// request's Accept-Encoding header, or "" if it shouldn't be compressed. The coding
+// with the highest quality value wins, and "*" stands for any coding which isn't
+// listed explicitly (RFC 9110 section 12.5.3).
+func acceptEncoding(header string) string {
+	qualities := make(map[string]float64)
+
+	for _, element := range strings.Split(header, ",") {
+		coding, params, _ := strings.Cut(element, ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		if coding == "" {
+			continue
+		}
+		if coding == "x-gzip" {
+			coding = "gzip"
+		}
+
+		q := 1.0
+		name, value, _ := strings.Cut(params, "=")
+		if strings.EqualFold(strings.TrimSpace(name), "q") {
+			var err error
+			q, err = strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if err != nil || q < 0 || q > 1 {
+				continue
+			}
+		}
+
+		qualities[coding] = q
+	}
+
+	var (
+		best        string
+		bestQuality float64
+	)
+
+	for _, coding := range compressEncodings {
+		q, ok := qualities[coding]
+		if !ok {
+			q = qualities["*"]
+		}
+		if q > bestQuality {
+			best, bestQuality = coding, q
+		}
+	}
+
+	return best
+}
+
+// The compress() middleware compresses the response body with gzip or brotli, if the
+// client accepts it. Only responses of at least config.compress.minSize bytes get
+// compressed, so the body is buffered until it reaches that size (or the handler
+// returns). The Vary: Accept-Encoding header is always added, because the response
+// could be different for a client with a different Accept-Encoding header.
+func (app *application) compress(next http.Handler) http.Handler {
+	if !app.config.compress.enabled {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+
+		encoding := acceptEncoding(r.Header.Get("Accept-Encoding"))
+		if encoding == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		cw := &compressResponseWriter{
+			wrapped:    w,
+			encoding:   encoding,
+			minSize:    app.config.compress.minSize,
+			statusCode: http.StatusOK,
+		}
+
+		next.ServeHTTP(cw, r)
+
+		err := cw.close()
+		if err != nil {
+			app.logError(r, err)
+		}
+	})
+}
+
+// compressResponseWriter holds back the status code and the start of the body until
+// it knows whether the response will be compressed. That's decided when the body
+// reaches the minimum size, when the handler flushes, or when the handler returns.
+type compressResponseWriter struct {
+	wrapped  http.ResponseWriter
+	encoding string
+	minSize  int
+
+	statusCode  int
+	wroteHeader bool
+	started     bool
+	buf         []byte
+	encoder     compressor
+}
+
+func (cw *compressResponseWriter) Header() http.Header {
+	return cw.wrapped.Header()
+}
+
+// WriteHeader() only records the status code, which is sent on when the response
+// starts. Informational (1xx) responses, like 103 Early Hints, don't end the response,
+// so they're passed straight through.
+func (cw *compressResponseWriter) WriteHeader(statusCode int) {
+	if cw.started {
+		cw.wrapped.WriteHeader(statusCode)
+		return
+	}
+
+	if statusCode >= 100 && statusCode <= 199 && statusCode != http.StatusSwitchingProtocols {
+		cw.wrapped.WriteHeader(statusCode)
+		return
+	}
+
+	if !cw.wroteHeader {
+		cw.statusCode = statusCode
+		cw.wroteHeader = true
+	}
+}
+
+func (cw *compressResponseWriter) Write(b []byte) (int, error) {
+	cw.wroteHeader = true
+
+	if !cw.started {
+		if len(cw.buf)+len(b) < cw.minSize {
+			cw.buf = append(cw.buf, b...)
+			return len(b), nil
+		}
+
+		err := cw.start(true)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if cw.encoder != nil {
+		return cw.encoder.Write(b)
+	}
+	return cw.wrapped.Write(b)
+}
+
+// start() sends the status code and headers, compressing the rest of the response if
+// worthwhile is true and the response is suitable, and writes out the buffered body.
+func (cw *compressResponseWriter) start(worthwhile bool) error {
+	cw.started = true
+
+	if worthwhile && cw.compressible() {
+		h := cw.Header()
+
+		// net/http sniffs the Content-Type from the body if it isn't set, which would
+		// go wrong on a compressed body, so sniff it ourselves from the original.
+		if h.Get("Content-Type") == "" {
+			h.Set("Content-Type", http.DetectContentType(cw.buf))
+		}
+
+		h.Set("Content-Encoding", cw.encoding)
+		h.Del("Content-Length")
+
+		cw.encoder = compressorPools[cw.encoding].Get().(compressor)
+		cw.encoder.Reset(cw.wrapped)
+	}
+
+	cw.wrapped.WriteHeader(cw.statusCode)
+
+	buf := cw.buf
+	cw.buf = nil
+
+	if len(buf) == 0 {
+		return nil
+	}
+	if cw.encoder != nil {
+		_, err := cw.encoder.Write(buf)
+		return err
+	}
+	_, err := cw.wrapped.Write(buf)
+	return err
+}
+
+// compressible() reports whether the response can be compressed. Responses without a
+// body, partial content, responses which already have a Content-Encoding and already
+// compressed content types are sent as they are.
+func (cw *compressResponseWriter) compressible() bool {
+	switch cw.statusCode {
+	case http.StatusNoContent, http.StatusNotModified, http.StatusPartialContent:
+		return false
+	}
+
+	h := cw.Header()
+	if h.Get("Content-Encoding") != "" {
+		return false
+	}
+
+	contentType := strings.ToLower(h.Get("Content-Type"))
+	for _, t := range incompressibleTypes {
+		if strings.HasPrefix(contentType, t) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// close() finishes the response once the handler has returned. A response which is
+// still buffered is smaller than the minimum size, so it's sent uncompressed.
+func (cw *compressResponseWriter) close() error {
+	if !cw.started {
+		// If the handler didn't write anything at all, leave it to net/http to send
+		// the default 200 OK response.
+		if !cw.wroteHeader {
+			return nil
+		}
+
+		err := cw.start(false)
+		if err != nil {
+			return err
+		}
+	}
+
+	if cw.encoder == nil {
+		return nil
+	}
+
+	err := cw.encoder.Close()
+	compressorPools[cw.encoding].Put(cw.encoder)
+	cw.encoder = nil
+
+	return err
+}
+
+// Flush() starts the response if it hasn't started yet. A handler which flushes is
+// streaming its response, so we can't know how big it will end up and compress it
+// regardless of the minimum size.
+func (cw *compressResponseWriter) Flush() {
+	if !cw.started {
+		cw.wroteHeader = true
+		if cw.start(true) != nil {
+			return
+		}
+	}
+
+	if cw.encoder != nil && cw.encoder.Flush() != nil {
+		return
+	}
+
+	if f, ok := cw.wrapped.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (cw *compressResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := cw.wrapped.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("%T does not implement http.Hijacker", cw.wrapped)
+	}
+	return h.Hijack()
+}
+
+func (cw *compressResponseWriter) Unwrap() http.ResponseWriter {
+	return cw.wrapped
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"expvar"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"delsanchez.gl/internal/apitest"
+	"delsanchez.gl/internal/data"
+	"delsanchez.gl/internal/jsonlog"
+	"github.com/andybalholm/brotli"
+)
+
+func TestCompress(t *testing.T) {
+	app := newTestApplication(t)
+	app.config.compress.enabled = true
+	app.config.compress.minSize = 1024
+
+	large := strings.Repeat("all work and no play makes jack a dull boy\n", 100)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/large", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(http.StatusCreated)
+		// Write the body in small pieces, so that the size threshold is crossed in
+		// the middle of a write.
+		for i := 0; i < len(large); i += 100 {
+			io.WriteString(w, large[i:min(i+100, len(large))])
+		}
+	})
+	mux.HandleFunc("/small", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "hello")
+	})
+	mux.HandleFunc("/image", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		io.WriteString(w, large)
+	})
+	mux.HandleFunc("/empty", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	ts := apitest.NewServer(t, app.metrics(app.compress(mux)))
+
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		acceptEncoding string
+		wantStatus     int
+		wantEncoding   string
+		wantBody       string
+	}{
+		{"gzip", http.MethodGet, "/large", "gzip", http.StatusCreated, "gzip", large},
+		{"brotli", http.MethodGet, "/large", "gzip, deflate, br", http.StatusCreated, "br", large},
+		{"Preferred by quality", http.MethodGet, "/large", "br;q=0.5, gzip", http.StatusCreated, "gzip", large},
+		{"Wildcard", http.MethodGet, "/large", "*", http.StatusCreated, "br", large},
+		{"Refused", http.MethodGet, "/large", "gzip;q=0, br;q=0", http.StatusCreated, "", large},
+		{"Not accepted", http.MethodGet, "/large", "identity", http.StatusCreated, "", large},
+		{"Below minimum size", http.MethodGet, "/small", "gzip", http.StatusOK, "", "hello"},
+		{"Already compressed", http.MethodGet, "/image", "gzip", http.StatusOK, "", large},
+		{"No content", http.MethodGet, "/empty", "gzip", http.StatusNoContent, "", ""},
+		{"HEAD", http.MethodHead, "/large", "gzip", http.StatusCreated, "gzip", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			res := ts.Do(tt.method, tt.path, nil, http.Header{"Accept-Encoding": {tt.acceptEncoding}})
+
+			res.AssertStatus(tt.wantStatus)
+
+			if got := res.Header.Get("Content-Encoding"); got != tt.wantEncoding {
+				t.Errorf("got Content-Encoding %q; want %q", got, tt.wantEncoding)
+			}
+			if got := res.Header.Values("Vary"); !slices.Contains(got, "Accept-Encoding") {
+				t.Errorf("got Vary %q; want it to include %q", got, "Accept-Encoding")
+			}
+
+			if got := string(decompress(t, tt.wantEncoding, res.Body)); got != tt.wantBody {
+				t.Errorf("got body %q; want %q", got, tt.wantBody)
+			}
+		})
+	}
+}
+
+// TestCompressMetrics checks that the metrics middleware still records the status
+// code which the handler wrote, although the compress middleware holds it back.
+func TestCompressMetrics(t *testing.T) {
+	app := newTestApplication(t)
+	app.config.compress.enabled = true
+	app.config.compress.minSize = 1024
+
+	ts := apitest.NewServer(t, app.metrics(app.compress(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+		io.WriteString(w, strings.Repeat("a", 2048))
+	}))))
+
+	count := func() int64 {
+		if v := totalResponsesSentByStatus.Get("202"); v != nil {
+			return v.(*expvar.Int).Value()
+		}
+		return 0
+	}
+
+	before := count()
+
+	res := ts.Do(http.MethodGet, "/", nil, http.Header{"Accept-Encoding": {"gzip"}})
+	res.AssertStatus(http.StatusAccepted)
+
+	if got := count() - before; got != 1 {
+		t.Errorf("got %d more 202 responses in the metrics; want 1", got)
+	}
+}
+
+func decompress(t *testing.T, encoding string, body []byte) []byte {
+	t.Helper()
+
+	var r io.Reader
+	switch encoding {
+	case "":
+		return body
+	case "gzip":
+		if len(body) == 0 {
+			return body
+		}
+		zr, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		r = zr
+	case "br":
+		r = brotli.NewReader(bytes.NewReader(body))
+	default:
+		t.Fatalf("unexpected Content-Encoding %q", encoding)
+	}
+
+	out, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestRequestID(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app)
+
+	tests := []struct {
+		name     string
+		incoming string
+		wantKept bool
+	}{
+		{"Generated", "", false},
+		{"Incoming", "3f2a-b7c1:edge/42", true},
+		{"Contains a space", "abc def", false},
+		{"Contains a tab", "abc\tdef", false},
+		{"Too long", strings.Repeat("a", 129), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var headers http.Header
+			if tt.incoming != "" {
+				headers = http.Header{"X-Request-Id": {tt.incoming}}
+			}
+
+			res := ts.Get("/v1/nothing-here", headers)
+
+			got := res.Header.Get("X-Request-ID")
+			if got == "" {
+				t.Fatal("got no X-Request-ID header")
+			}
+			if tt.wantKept && got != tt.incoming {
+				t.Errorf("got X-Request-ID %q; want %q", got, tt.incoming)
+			}
+			if !tt.wantKept && got == tt.incoming {
+				t.Errorf("got X-Request-ID %q; want a generated ID", got)
+			}
+
+			var bodyID string
+			res.Decode("request_id", &bodyID)
+
+			if bodyID != got {
+				t.Errorf("got request_id %q in the body; want %q", bodyID, got)
+			}
+		})
+	}
+
+	t.Run("Unique", func(t *testing.T) {
+		first := ts.Get("/v1/healthcheck", nil).Header.Get("X-Request-ID")
+		second := ts.Get("/v1/healthcheck", nil).Header.Get("X-Request-ID")
+
+		if first == second {
+			t.Errorf("got the same request ID %q twice", first)
+		}
+	})
+}
+
+func TestRateLimit(t *testing.T) {
+	app := newTestApplication(t)
+	app.config.limiter.enabled = true
+	app.config.limiter.rps = 0.001
+	app.config.limiter.burst = 1
+
+	ts := newTestServer(t, app)
+
+	ts.Get("/v1/healthcheck", nil).AssertStatus(http.StatusOK)
+
+	res := ts.Get("/v1/healthcheck", nil)
+	res.AssertError(http.StatusTooManyRequests, "rate limit exceeded")
+
+	// A client which is still being seen keeps its limiter...
+	app.rateLimitClients.sweep(time.Minute)
+	ts.Get("/v1/healthcheck", nil).AssertStatus(http.StatusTooManyRequests)
+
+	// ...but once it has been idle for long enough the sweep forgets it, and it starts
+	// again with a full bucket.
+	app.rateLimitClients.sweep(0)
+	ts.Get("/v1/healthcheck", nil).AssertStatus(http.StatusOK)
+}
+
+// panicMovieStore is a MovieStore whose Get() panics.
+type panicMovieStore struct {
+	data.MovieStore
+}
+
+func (panicMovieStore) Get(ctx context.Context, id int64) (*data.Movie, error) {
+	panic("boom")
+}
+
+// recoverPanic() wraps the whole chain, so the request ID has to be recovered from the
+// response headers, and the metrics middleware has to count the 500 it sends.
+func TestRecoverPanic(t *testing.T) {
+	var logs bytes.Buffer
+
+	app := newTestApplication(t)
+	app.logger = jsonlog.New(&logs, jsonlog.LevelError, jsonlog.FormatJSON)
+	app.models.Movies = panicMovieStore{app.models.Movies}
+
+	ts := newTestServer(t, app)
+
+	count := func() int64 {
+		if v := totalResponsesSentByStatus.Get("500"); v != nil {
+			return v.(*expvar.Int).Value()
+		}
+		return 0
+	}
+
+	before := count()
+
+	headers := app.authHeader(t, "movies:read")
+	headers.Set("X-Request-ID", "panic-request")
+
+	res := ts.Get("/v1/movies/1", headers)
+
+	res.AssertError(http.StatusInternalServerError, "the server encountered a problem and could not process your request")
+
+	var requestID string
+	res.Decode("request_id", &requestID)
+
+	if requestID != "panic-request" {
+		t.Errorf("got request_id %q in the body; want %q", requestID, "panic-request")
+	}
+	if !strings.Contains(logs.String(), `"request_id":"panic-request"`) {
+		t.Errorf("got log %q; want it to include the request ID", logs.String())
+	}
+	if got := count() - before; got != 1 {
+		t.Errorf("got %d more 500 responses in the metrics; want 1", got)
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+
+	"delsanchez.gl/internal/migrate"
+	"delsanchez.gl/migrations"
+)
+
+const migrateUsage = "usage: api migrate up|down|status|goto N"
+
+// runMigrate() handles the `api migrate` subcommand. The args are whatever follows
+// "migrate" on the command line, and any status output is written to out.
+func runMigrate(db *sql.DB, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+
+	migrator, err := migrate.New(db, migrations.FS)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+
+	switch args[0] {
+	case "up":
+		err = migrator.Up(ctx)
+	case "down":
+		err = migrator.Down(ctx)
+	case "goto":
+		if len(args) != 2 {
+			return errors.New(migrateUsage)
+		}
+		version, parseErr := strconv.ParseInt(args[1], 10, 64)
+		if parseErr != nil || version < 0 {
+			return fmt.Errorf("invalid migration version %q", args[1])
+		}
+		err = migrator.Goto(ctx, version)
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		for _, s := range statuses {
+			state := "pending"
+			if s.Applied {
+				state = "applied " + s.AppliedAt.Format("2006-01-02 15:04:05 MST")
+			}
+			fmt.Fprintf(out, "%06d  %-40s  %s\n", s.Version, s.Name, state)
+		}
+		return nil
+	default:
+		return errors.New(migrateUsage)
+	}
+
+	// Running migrations against an up-to-date database isn't an error.
+	if errors.Is(err, migrate.ErrNoChange) {
+		fmt.Fprintln(out, "no change")
+		return nil
+	}
+	return err
+}
+
+// autoMigrate() applies any pending migrations. It's called at startup when the
+// -db-auto-migrate flag is set.
+func (app *application) autoMigrate(db *sql.DB) error {
+	migrator, err := migrate.New(db, migrations.FS)
+	if err != nil {
+		return err
+	}
+
+	err = migrator.Up(context.Background())
+	switch {
+	case errors.Is(err, migrate.ErrNoChange):
+		app.logger.PrintInfo("database schema is up to date", nil)
+	case err != nil:
+		return err
+	default:
+		app.logger.PrintInfo("database migrations applied", nil)
+	}
+
+	return nil
+}
@@ -1,9 +1,9 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
-	"time"
 
 	"delsanchez.gl/internal/data"
 	"delsanchez.gl/internal/validator"
@@ -47,30 +47,372 @@ func (app *application) createMovieHandler(w http.ResponseWriter, r *http.Reques
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
-	// Dump the contents of the input struct in a HTTP response.
-	fmt.Fprintf(w, "%+v\n", input)
+
+	// Call the Insert() method on the movies model, passing in a pointer to the
+	// validated movie struct. This will create a record in the database and update
+	// the movie struct with the system-generated information.
+	err = app.models.Movies.Insert(r.Context(), movie)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// When sending a HTTP response, we want to include a Location header to let the
+	// client know which URL they can find the newly-created resource at.
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/movies/%d", movie.ID))
+	headers.Set("ETag", movieETag(movie.Version))
+
+	// Write a JSON response with a 201 Created status code, the movie data in the
+	// response body, and the Location header.
+	err = app.writeResponse(w, r, http.StatusCreated, envelope{"movie": movie}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
 }
 
-// for "GET /v1/movies/:id" endpoint. For now, we'll retrieve the interpolated id
+// for "GET /v1/movies/:id" endpoint.
 func (app *application) showMovieHandler(w http.ResponseWriter, r *http.Request) {
 	id, err := app.readIDParam(r)
 	if err != nil {
 		app.notFoundResponse(w, r)
 		return
 	}
-	// Create a new instance of the Movie struct, containing the ID extracted from the URL
-	// and some dummy data. No year field yet.
-	movie := data.Movie{
-		ID:        id,
-		CreatedAt: time.Now(),
-		Title:     "Casablanca",
-		Runtime:   102,
-		Genres:    []string{"drama", "romance", "war"},
-		Version:   1,
+	// Call the Get() method to fetch the data for a specific movie. We use the
+	// errors.Is() function to check if it returned a data.ErrRecordNotFound error,
+	// in which case we send a 404 Not Found response to the client.
+	movie, err := app.models.Movies.Get(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
 	}
+	// Include the ETag header so that the client can make a conditional update
+	// later by sending it back in an If-Match header.
+	headers := make(http.Header)
+	headers.Set("ETag", movieETag(movie.Version))
+
 	// Encode the struct to JSON and send it as HTTP response.
-	err = app.writeJSON(w, http.StatusOK, envelope{"movie": movie}, nil)
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"movie": movie}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// for "GET /v1/movies" endpoint. Supports the title, genres, page, page_size and
+// sort query string parameters.
+func (app *application) listMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	// An input struct to hold the expected values from the request query string.
+	var input struct {
+		Title  string
+		Genres []string
+		data.Filters
+	}
+
+	v := validator.New()
+
+	// Call r.URL.Query() to get the url.Values map containing the query string data.
+	qs := r.URL.Query()
+
+	// Use the helpers to extract the title and genres query string values, falling
+	// back to defaults of an empty string and an empty slice respectively.
+	input.Title = app.readString(qs, "title", "")
+	input.Genres = app.readCSV(qs, "genres", []string{})
+
+	// Get the page and page_size query string values as integers. Notice that we set
+	// the default page value to 1 and default page_size to 20.
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+
+	// Extract the sort query string value, falling back to "id" if it is not provided
+	// by the client (which will imply an ascending sort on movie ID).
+	input.Filters.Sort = app.readString(qs, "sort", "id")
+	// Add the supported sort values for this endpoint to the sort safelist.
+	input.Filters.SortSafelist = []string{"id", "title", "year", "runtime", "-id", "-title", "-year", "-runtime"}
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	movies, metadata, err := app.models.Movies.GetAll(r.Context(), input.Title, input.Genres, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"movies": movies, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// for "PUT /v1/movies/:id" endpoint. The client sends the full movie record, which
+// replaces the existing one.
+func (app *application) updateMovieHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	// Fetch the existing movie record from the database, sending a 404 Not Found
+	// response to the client if we couldn't find a matching record.
+	movie, err := app.models.Movies.Get(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// If the request contains an If-Match header, make sure the client is working
+	// from the current version of the movie before changing anything.
+	if !app.ifMatch(r, movieETag(movie.Version)) {
+		app.preconditionFailedResponse(w, r)
+		return
+	}
+
+	// Declare an input struct to hold the expected data from the client.
+	var input struct {
+		Title   string       `json:"title"`
+		Year    int32        `json:"year"`
+		Runtime data.Runtime `json:"runtime"`
+		Genres  []string     `json:"genres"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	// Copy the values from the request body to the appropriate fields of the movie
+	// record.
+	movie.Title = input.Title
+	movie.Year = input.Year
+	movie.Runtime = input.Runtime
+	movie.Genres = input.Genres
+
+	v := validator.New()
+
+	if data.ValidateMovie(v, movie); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Pass the updated movie record to the Update() method. If the movie was changed
+	// by another request since we fetched it, send a 409 Conflict response.
+	err = app.models.Movies.Update(r.Context(), movie)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("ETag", movieETag(movie.Version))
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"movie": movie}, headers)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
 }
+
+// for "PATCH /v1/movies/:id" endpoint. Unlike PUT, the client only needs to send the
+// fields that it wants to change, e.g. {"runtime": "110 mins"}.
+func (app *application) patchMovieHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	movie, err := app.models.Movies.Get(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if !app.ifMatch(r, movieETag(movie.Version)) {
+		app.preconditionFailedResponse(w, r)
+		return
+	}
+
+	// Using data.Optional for the input fields lets us tell apart a field which was
+	// left out of the request body (and should keep its current value), a field
+	// which was explicitly set to null, and a field with a new value.
+	var input struct {
+		Title   data.Optional[string]       `json:"title"`
+		Year    data.Optional[int32]        `json:"year"`
+		Runtime data.Optional[data.Runtime] `json:"runtime"`
+		Genres  data.Optional[[]string]     `json:"genres"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	// All the movie fields are required, so an explicit null can never be valid.
+	v.Check(!input.Title.Null, "title", "must not be null")
+	v.Check(!input.Year.Null, "year", "must not be null")
+	v.Check(!input.Runtime.Null, "runtime", "must not be null")
+	v.Check(!input.Genres.Null, "genres", "must not be null")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Copy over only the fields which were present in the request body.
+	if input.Title.Set {
+		movie.Title = input.Title.Value
+	}
+	if input.Year.Set {
+		movie.Year = input.Year.Value
+	}
+	if input.Runtime.Set {
+		movie.Runtime = input.Runtime.Value
+	}
+	if input.Genres.Set {
+		movie.Genres = input.Genres.Value
+	}
+
+	// The merged record still has to pass the same checks as a brand new movie.
+	if data.ValidateMovie(v, movie); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Movies.Update(r.Context(), movie)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("ETag", movieETag(movie.Version))
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"movie": movie}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// for "DELETE /v1/movies/:id" endpoint.
+func (app *application) deleteMovieHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	// If the client sent an If-Match header, fetch the current movie so that we can
+	// check the client isn't deleting a version of the record it hasn't seen.
+	if r.Header.Get("If-Match") != "" {
+		movie, err := app.models.Movies.Get(r.Context(), id)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				app.notFoundResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		if !app.ifMatch(r, movieETag(movie.Version)) {
+			app.preconditionFailedResponse(w, r)
+			return
+		}
+	}
+
+	// Delete the movie from the database, sending a 404 Not Found response to the
+	// client if there isn't a matching record.
+	err = app.models.Movies.Delete(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Return a 200 OK status code along with a success message.
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"message": "movie successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// styledMovie is a movie whose runtime is written in a particular style. The Runtime
+// field shadows the one in data.Movie, and all the other fields come from data.Movie
+// itself. (The encoders put the shadowing field after the embedded ones, so the
+// runtime is the last key of a styled movie.)
+type styledMovie struct {
+	*data.Movie
+	Runtime data.StyledRuntime
+}
+
+func newStyledMovie(movie *data.Movie, style data.RuntimeStyle) styledMovie {
+	return styledMovie{
+		Movie:   movie,
+		Runtime: data.StyledRuntime{Runtime: movie.Runtime, Style: style},
+	}
+}
+
+// styleRuntimes() returns a copy of env in which the movies are replaced by
+// styledMovies, if the client asked for a runtime style other than the default one
+// (see the runtimeStyle() middleware). Otherwise env is returned as it is.
+func (app *application) styleRuntimes(r *http.Request, env envelope) envelope {
+	style := app.contextGetRuntimeStyle(r)
+	if style == data.RuntimeStyleMins {
+		return env
+	}
+
+	styled := make(envelope, len(env))
+
+	for key, value := range env {
+		switch value := value.(type) {
+		case *data.Movie:
+			styled[key] = newStyledMovie(value, style)
+		case []*data.Movie:
+			movies := make([]styledMovie, len(value))
+			for i, movie := range value {
+				movies[i] = newStyledMovie(movie, style)
+			}
+			styled[key] = movies
+		default:
+			styled[key] = value
+		}
+	}
+
+	return styled
+}
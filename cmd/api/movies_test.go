@@ -0,0 +1,285 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"testing"
+
+	"delsanchez.gl/internal/data"
+)
+
+func TestCreateMovie(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app)
+
+	writer := app.authHeader(t, "movies:read", "movies:write")
+
+	validMovie := map[string]any{
+		"title":   "Moana",
+		"year":    2016,
+		"runtime": "107 mins",
+		"genres":  []string{"animation", "adventure"},
+	}
+
+	t.Run("Valid", func(t *testing.T) {
+		res := ts.Do(http.MethodPost, "/v1/movies", validMovie, writer)
+
+		res.AssertStatus(http.StatusCreated)
+
+		var movie data.Movie
+		res.Decode("movie", &movie)
+
+		if got, want := res.Header.Get("Location"), "/v1/movies/1"; got != want {
+			t.Errorf("got Location %q; want %q", got, want)
+		}
+		if got, want := res.Header.Get("ETag"), `"1"`; got != want {
+			t.Errorf("got ETag %q; want %q", got, want)
+		}
+
+		res.AssertGolden("create_movie", "CreatedAt")
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		res := ts.Do(http.MethodPost, "/v1/movies", map[string]any{
+			"title":   "",
+			"year":    1800,
+			"runtime": "0 mins",
+			"genres":  []string{"drama", "drama"},
+		}, writer)
+
+		res.AssertError(http.StatusUnprocessableEntity, map[string]string{
+			"title":   "must be provided",
+			"year":    "must be greater that 1888",
+			"runtime": "must be provided",
+			"genres":  "must not contain duplicate values",
+		})
+	})
+
+	t.Run("Anonymous", func(t *testing.T) {
+		res := ts.Do(http.MethodPost, "/v1/movies", validMovie, nil)
+
+		res.AssertError(http.StatusUnauthorized, "you must be authenticated to access this resource")
+	})
+
+	t.Run("NotPermitted", func(t *testing.T) {
+		res := ts.Do(http.MethodPost, "/v1/movies", validMovie, app.authHeader(t, "movies:read"))
+
+		res.AssertError(http.StatusForbidden, "your user account doesn't have the necessary permissions to access this resource")
+	})
+}
+
+func TestShowMovie(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app)
+
+	err := app.models.Movies.Insert(context.Background(), &data.Movie{
+		Title:   "Casablanca",
+		Year:    1942,
+		Runtime: 102,
+		Genres:  []string{"drama", "romance", "war"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reader := app.authHeader(t, "movies:read")
+
+	tests := []struct {
+		name       string
+		path       string
+		wantStatus int
+	}{
+		{"Valid ID", "/v1/movies/1", http.StatusOK},
+		{"Non-existent ID", "/v1/movies/2", http.StatusNotFound},
+		{"Negative ID", "/v1/movies/-1", http.StatusNotFound},
+		{"Decimal ID", "/v1/movies/1.23", http.StatusNotFound},
+		{"String ID", "/v1/movies/foo", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := ts.Get(tt.path, reader)
+
+			if tt.wantStatus == http.StatusNotFound {
+				res.AssertError(http.StatusNotFound, "the requested resource could not be found")
+				return
+			}
+
+			res.AssertStatus(tt.wantStatus)
+
+			if got, want := res.Header.Get("ETag"), `"1"`; got != want {
+				t.Errorf("got ETag %q; want %q", got, want)
+			}
+
+			res.AssertGolden("show_movie", "CreatedAt")
+		})
+	}
+}
+
+func TestListMoviesMetadata(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app)
+
+	for _, title := range []string{"Casablanca", "Moana", "Frozen"} {
+		err := app.models.Movies.Insert(context.Background(), &data.Movie{
+			Title:   title,
+			Year:    2000,
+			Runtime: 100,
+			Genres:  []string{"drama"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	reader := app.authHeader(t, "movies:read")
+
+	tests := []struct {
+		name       string
+		query      string
+		wantMovies int
+		want       data.Metadata
+	}{
+		{
+			name:       "Last page",
+			query:      "?page=2&page_size=2",
+			wantMovies: 1,
+			want:       data.Metadata{CurrentPage: 2, PageSize: 2, FirstPage: 1, LastPage: 2, TotalRecords: 3},
+		},
+		{
+			name:       "Past the end",
+			query:      "?page=5&page_size=2",
+			wantMovies: 0,
+			want:       data.Metadata{CurrentPage: 5, PageSize: 2, FirstPage: 1, LastPage: 2, TotalRecords: 3},
+		},
+		{
+			name:       "No matches",
+			query:      "?title=nothing",
+			wantMovies: 0,
+			want:       data.Metadata{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := ts.Get("/v1/movies"+tt.query, reader)
+
+			res.AssertStatus(http.StatusOK)
+
+			var movies []data.Movie
+			res.Decode("movies", &movies)
+
+			var metadata data.Metadata
+			res.Decode("metadata", &metadata)
+
+			if len(movies) != tt.wantMovies {
+				t.Errorf("got %d movies; want %d", len(movies), tt.wantMovies)
+			}
+			if metadata != tt.want {
+				t.Errorf("got metadata %+v; want %+v", metadata, tt.want)
+			}
+		})
+	}
+}
+
+func TestRuntimeStyle(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app)
+
+	err := app.models.Movies.Insert(context.Background(), &data.Movie{
+		Title:   "Casablanca",
+		Year:    1942,
+		Runtime: 102,
+		Genres:  []string{"drama", "romance", "war"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reader := app.authHeader(t, "movies:read")
+
+	tests := []struct {
+		name  string
+		style string
+		want  string
+	}{
+		{name: "Default", style: "", want: `"102 mins"`},
+		{name: "Mins", style: "mins", want: `"102 mins"`},
+		{name: "Minutes", style: "minutes", want: `102`},
+		{name: "ISO 8601", style: "iso8601", want: `"PT1H42M"`},
+		{name: "Duration", style: "DURATION", want: `"1h42m"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, path := range []string{"/v1/movies/1", "/v1/movies"} {
+				res := ts.Get(path+"?runtime_style="+tt.style, reader)
+
+				res.AssertStatus(http.StatusOK)
+
+				var movie map[string]json.RawMessage
+				if path == "/v1/movies" {
+					var movies []map[string]json.RawMessage
+					res.Decode("movies", &movies)
+					movie = movies[0]
+				} else {
+					res.Decode("movie", &movie)
+				}
+
+				if got := string(movie["Runtime"]); got != tt.want {
+					t.Errorf("%s: got runtime %s; want %s", path, got, tt.want)
+				}
+
+				var keys []string
+				for key := range movie {
+					keys = append(keys, key)
+				}
+				slices.Sort(keys)
+				wantKeys := []string{"CreatedAt", "Genres", "ID", "Runtime", "Title", "Version", "Year"}
+				if !slices.Equal(keys, wantKeys) {
+					t.Errorf("%s: got keys %q; want %q", path, keys, wantKeys)
+				}
+			}
+		})
+	}
+
+	t.Run("Invalid", func(t *testing.T) {
+		res := ts.Get("/v1/movies/1?runtime_style=hours", reader)
+
+		res.AssertError(http.StatusUnprocessableEntity, map[string]string{
+			"runtime_style": "must be one of mins|minutes|iso8601|duration",
+		})
+	})
+
+	// The parameter only means something on the routes which respond with movies.
+	t.Run("Other routes", func(t *testing.T) {
+		res := ts.Get("/v1/healthcheck?runtime_style=hours", nil)
+
+		res.AssertStatus(http.StatusOK)
+	})
+
+	// A runtime can be given in any format that ParseRuntime() accepts.
+	t.Run("Input", func(t *testing.T) {
+		writer := app.authHeader(t, "movies:read", "movies:write")
+
+		for _, runtime := range []any{"1h47m", "PT1H47M", "107 minutes", "107", 107} {
+			res := ts.Do(http.MethodPost, "/v1/movies", map[string]any{
+				"title":   "Moana",
+				"year":    2016,
+				"runtime": runtime,
+				"genres":  []string{"animation"},
+			}, writer)
+
+			res.AssertStatus(http.StatusCreated)
+
+			var movie data.Movie
+			res.Decode("movie", &movie)
+
+			if movie.Runtime != 107 {
+				t.Errorf("%v: got runtime %d; want 107", runtime, movie.Runtime)
+			}
+		}
+	})
+}
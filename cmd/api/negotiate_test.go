@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+
+	"delsanchez.gl/internal/data"
+)
+
+func TestContentNegotiation(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app)
+
+	err := app.models.Movies.Insert(context.Background(), &data.Movie{
+		Title:   "Casablanca",
+		Year:    1942,
+		Runtime: 102,
+		Genres:  []string{"drama", "romance", "war"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reader := app.authHeader(t, "movies:read")
+
+	tests := []struct {
+		name            string
+		path            string
+		accept          string
+		wantStatus      int
+		wantContentType string
+		wantBody        []string
+	}{
+		{
+			name:            "No Accept header",
+			path:            "/v1/movies/1",
+			wantStatus:      http.StatusOK,
+			wantContentType: "application/json",
+			wantBody:        []string{`"Runtime": "102 mins"`},
+		},
+		{
+			name:            "Wildcard",
+			path:            "/v1/movies/1",
+			accept:          "*/*",
+			wantStatus:      http.StatusOK,
+			wantContentType: "application/json",
+		},
+		{
+			name:            "XML",
+			path:            "/v1/movies/1",
+			accept:          "application/xml",
+			wantStatus:      http.StatusOK,
+			wantContentType: "application/xml; charset=utf-8",
+			wantBody: []string{
+				"<response>\n\t<movie>\n\t\t<ID>1</ID>",
+				"<Runtime>102 mins</Runtime>",
+				"<Genres>\n\t\t\t<item>drama</item>",
+			},
+		},
+		{
+			name:            "Preferred by quality",
+			path:            "/v1/movies/1",
+			accept:          "application/json;q=0.5, text/xml;q=0.9",
+			wantStatus:      http.StatusOK,
+			wantContentType: "application/xml; charset=utf-8",
+		},
+		{
+			name:            "MessagePack",
+			path:            "/v1/movies/1",
+			accept:          "application/x-msgpack",
+			wantStatus:      http.StatusOK,
+			wantContentType: "application/msgpack",
+			wantBody:        []string{"\xa7Runtime\xa8102 mins"},
+		},
+		{
+			name:            "CSV list",
+			path:            "/v1/movies",
+			accept:          "text/csv",
+			wantStatus:      http.StatusOK,
+			wantContentType: "text/csv; charset=utf-8",
+			wantBody: []string{
+				"ID,CreatedAt,Title,Year,Runtime,Genres,Version\n",
+				`,Casablanca,1942,102 mins,"[""drama"",""romance"",""war""]",1` + "\n",
+			},
+		},
+		{
+			name:            "CSV single movie falls back",
+			path:            "/v1/movies/1",
+			accept:          "text/csv, application/json;q=0.1",
+			wantStatus:      http.StatusOK,
+			wantContentType: "application/json",
+		},
+		{
+			name:            "CSV single movie only",
+			path:            "/v1/movies/1",
+			accept:          "text/csv",
+			wantStatus:      http.StatusNotAcceptable,
+			wantContentType: "application/json",
+			wantBody:        []string{"supported types are: application/json, application/xml, application/msgpack"},
+		},
+		{
+			name:            "Nothing acceptable",
+			path:            "/v1/movies",
+			accept:          "text/html, application/json;q=0",
+			wantStatus:      http.StatusNotAcceptable,
+			wantContentType: "application/json",
+			wantBody:        []string{"supported types are: application/json, application/xml, text/csv, application/msgpack"},
+		},
+		{
+			name:            "Error response",
+			path:            "/v1/nothing-here",
+			accept:          "text/html",
+			wantStatus:      http.StatusNotFound,
+			wantContentType: "application/json",
+		},
+		{
+			name:            "XML error response",
+			path:            "/v1/movies/2",
+			accept:          "application/xml",
+			wantStatus:      http.StatusNotFound,
+			wantContentType: "application/xml; charset=utf-8",
+			wantBody:        []string{"<error>the requested resource could not be found</error>"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			headers := reader.Clone()
+			if tt.accept != "" {
+				headers.Set("Accept", tt.accept)
+			}
+
+			res := ts.Get(tt.path, headers)
+
+			res.AssertStatus(tt.wantStatus)
+
+			if got := res.Header.Get("Content-Type"); got != tt.wantContentType {
+				t.Errorf("got Content-Type %q; want %q", got, tt.wantContentType)
+			}
+			if got := res.Header.Values("Vary"); !slices.Contains(got, "Accept") {
+				t.Errorf("got Vary %q; want it to include %q", got, "Accept")
+			}
+
+			for _, want := range tt.wantBody {
+				if !strings.Contains(string(res.Body), want) {
+					t.Errorf("got body %q; want it to contain %q", res.Body, want)
+				}
+			}
+		})
+	}
+}
+
+// The format is negotiated before the handler runs, so a request which ends up with a
+// 406 response doesn't change anything.
+func TestNotAcceptableBeforeHandler(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app)
+
+	headers := app.authHeader(t, "movies:read", "movies:write")
+	headers.Set("Accept", "text/html")
+
+	res := ts.Do(http.MethodPost, "/v1/movies", map[string]any{
+		"title":   "Moana",
+		"year":    2016,
+		"runtime": "107 mins",
+		"genres":  []string{"animation"},
+	}, headers)
+
+	res.AssertStatus(http.StatusNotAcceptable)
+
+	_, err := app.models.Movies.Get(context.Background(), 1)
+	if !errors.Is(err, data.ErrRecordNotFound) {
+		t.Errorf("got error %v; want the movie not to have been created", err)
+	}
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+// The OpenAPI 3.1 description of the API. It's written by hand and embedded in the
+// binary, so it must be kept in step with routes() (TestOpenAPICoversRoutes checks
+// that every registered route is documented).
+//
+//go:embed openapi.json
+var openAPISpec []byte
+
+// openAPIHandler serves the OpenAPI document. The document is already JSON so it's
+// written out as-is, rather than being passed through writeResponse().
+func (app *application) openAPIHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(openAPISpec)
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"encoding/json"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+type openAPIDocument struct {
+	OpenAPI string                    `json:"openapi"`
+	Paths   map[string]map[string]any `json:"paths"`
+	raw     map[string]any
+}
+
+func decodeOpenAPI(t *testing.T, js []byte) openAPIDocument {
+	t.Helper()
+
+	var doc openAPIDocument
+
+	err := json.Unmarshal(js, &doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = json.Unmarshal(js, &doc.raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return doc
+}
+
+// registeredRoutes() returns the method and path of every route registered in
+// routes(), with httprouter's :name parameters rewritten to OpenAPI's {name} form.
+// httprouter has no way to list its routes, so they're read from the source code of
+// routes.go instead.
+func registeredRoutes(t *testing.T) map[string][]string {
+	t.Helper()
+
+	f, err := parser.ParseFile(token.NewFileSet(), "routes.go", nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	param := regexp.MustCompile(`:(\w+)`)
+	routes := make(map[string][]string)
+
+	ast.Inspect(f, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok || len(call.Args) < 2 {
+			return true
+		}
+
+		fun, ok := call.Fun.(*ast.SelectorExpr)
+		if !ok || (fun.Sel.Name != "HandlerFunc" && fun.Sel.Name != "Handler") {
+			return true
+		}
+		if recv, ok := fun.X.(*ast.Ident); !ok || recv.Name != "router" {
+			return true
+		}
+
+		method, ok := call.Args[0].(*ast.SelectorExpr)
+		if !ok || !strings.HasPrefix(method.Sel.Name, "Method") {
+			t.Fatalf("route method must be a net/http Method constant, got %T", call.Args[0])
+		}
+
+		lit, ok := call.Args[1].(*ast.BasicLit)
+		if !ok {
+			t.Fatalf("route path must be a string literal, got %T", call.Args[1])
+		}
+
+		path, err := strconv.Unquote(lit.Value)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		path = param.ReplaceAllString(path, "{$1}")
+		routes[path] = append(routes[path], strings.ToLower(strings.TrimPrefix(method.Sel.Name, "Method")))
+
+		return true
+	})
+
+	if len(routes) == 0 {
+		t.Fatal("found no routes in routes.go")
+	}
+
+	return routes
+}
+
+func TestOpenAPICoversRoutes(t *testing.T) {
+	doc := decodeOpenAPI(t, openAPISpec)
+	routes := registeredRoutes(t)
+
+	for path, methods := range routes {
+		for _, method := range methods {
+			if _, ok := doc.Paths[path][method]; !ok {
+				t.Errorf("%s %s is registered in routes() but missing from openapi.json", strings.ToUpper(method), path)
+			}
+		}
+	}
+
+	// The reverse shouldn't happen either: the spec mustn't describe routes that
+	// don't exist.
+	for path, item := range doc.Paths {
+		for method := range item {
+			if method == "parameters" || method == "summary" || method == "description" {
+				continue
+			}
+
+			found := false
+			for _, m := range routes[path] {
+				found = found || m == method
+			}
+
+			if !found {
+				t.Errorf("%s %s is in openapi.json but not registered in routes()", strings.ToUpper(method), path)
+			}
+		}
+	}
+}
+
+func TestOpenAPIReferences(t *testing.T) {
+	doc := decodeOpenAPI(t, openAPISpec)
+
+	if doc.OpenAPI != "3.1.0" {
+		t.Errorf("got openapi version %q; want %q", doc.OpenAPI, "3.1.0")
+	}
+
+	// Walk the whole document and check every local $ref points at something.
+	var walk func(v any)
+	walk = func(v any) {
+		switch v := v.(type) {
+		case map[string]any:
+			if ref, ok := v["$ref"].(string); ok {
+				if resolveRef(doc.raw, ref) == nil {
+					t.Errorf("unresolved $ref %q", ref)
+				}
+			}
+			for _, child := range v {
+				walk(child)
+			}
+		case []any:
+			for _, child := range v {
+				walk(child)
+			}
+		}
+	}
+
+	walk(doc.raw)
+}
+
+func resolveRef(doc map[string]any, ref string) any {
+	pointer, ok := strings.CutPrefix(ref, "#/")
+	if !ok {
+		return nil
+	}
+
+	var node any = doc
+	for _, key := range strings.Split(pointer, "/") {
+		m, ok := node.(map[string]any)
+		if !ok {
+			return nil
+		}
+		node = m[key]
+	}
+
+	return node
+}
+
+func TestShowOpenAPI(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app)
+
+	res := ts.Get("/v1/openapi.json", nil)
+
+	res.AssertStatus(http.StatusOK)
+
+	if got := res.Header.Get("Content-Type"); got != "application/json" {
+		t.Errorf("got Content-Type %q; want %q", got, "application/json")
+	}
+
+	if string(res.Body) != string(openAPISpec) {
+		t.Error("response body doesn't match the embedded openapi.json")
+	}
+}
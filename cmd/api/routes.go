@@ -1,12 +1,16 @@
 package main
 
 import (
+	"expvar"
 	"net/http"
 
+	"delsanchez.gl/internal/render"
 	"github.com/julienschmidt/httprouter"
 )
 
-func (app *application) routes() *httprouter.Router {
+// Update the routes() method to return a http.Handler instead of a *httprouter.Router,
+// so that we can wrap the router in middleware.
+func (app *application) routes() http.Handler {
 	// Initialize a new httprouter router instance
 	router := httprouter.New()
 
@@ -20,11 +24,41 @@ func (app *application) routes() *httprouter.Router {
 	router.MethodNotAllowed = http.HandlerFunc(app.methodNotAllowedResponse)
 
 	// Register the relevant methods, URL patterns, and handler function for the
-	// endpoints using HandlerFunc() method.
-	router.HandlerFunc(http.MethodGet, "/v1/healthcheck", app.healthCheckHandler)
-	router.HandlerFunc(http.MethodPost, "/v1/movies", app.createMovieHandler)
-	router.HandlerFunc(http.MethodGet, "/v1/movies/:id", app.showMovieHandler)
+	// endpoints using HandlerFunc() method. The negotiate() middleware chooses the
+	// response format before each handler runs, offering CSV only for lists.
+	router.HandlerFunc(http.MethodGet, "/v1/healthcheck", app.negotiate(render.ObjectFormats, app.healthCheckHandler))
 
-	// Returning the httprouter instance
-	return router
+	// Use the requirePermission() middleware on each of the /v1/movies** endpoints,
+	// passing in the required permission code as the first parameter. The endpoints
+	// which respond with movies also use the runtimeStyle() middleware.
+	router.HandlerFunc(http.MethodGet, "/v1/movies", app.requirePermission("movies:read", app.negotiate(render.Formats, app.runtimeStyle(app.listMoviesHandler))))
+	router.HandlerFunc(http.MethodPost, "/v1/movies", app.requirePermission("movies:write", app.negotiate(render.ObjectFormats, app.runtimeStyle(app.createMovieHandler))))
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id", app.requirePermission("movies:read", app.negotiate(render.ObjectFormats, app.runtimeStyle(app.showMovieHandler))))
+	router.HandlerFunc(http.MethodPut, "/v1/movies/:id", app.requirePermission("movies:write", app.negotiate(render.ObjectFormats, app.runtimeStyle(app.updateMovieHandler))))
+	router.HandlerFunc(http.MethodPatch, "/v1/movies/:id", app.requirePermission("movies:write", app.negotiate(render.ObjectFormats, app.runtimeStyle(app.patchMovieHandler))))
+	router.HandlerFunc(http.MethodDelete, "/v1/movies/:id", app.requirePermission("movies:write", app.negotiate(render.ObjectFormats, app.deleteMovieHandler)))
+
+	router.HandlerFunc(http.MethodPost, "/v1/users", app.negotiate(render.ObjectFormats, app.registerUserHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/users/activated", app.negotiate(render.ObjectFormats, app.activateUserHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/authentication", app.negotiate(render.ObjectFormats, app.createAuthenticationTokenHandler))
+
+	// Serve the OpenAPI document describing all of the above.
+	router.HandlerFunc(http.MethodGet, "/v1/openapi.json", app.openAPIHandler)
+
+	// Register a new GET /debug/vars endpoint pointing to the expvar handler. It's
+	// only registered when the -metrics-enabled flag is set, so that the metrics
+	// aren't exposed to everyone by default.
+	if app.config.metrics.enabled {
+		router.Handler(http.MethodGet, "/debug/vars", expvar.Handler())
+	}
+
+	// Wrap the router with the headAsGet() middleware, so that HEAD requests reach the
+	// GET handlers, then the authenticate() middleware, then the rate limiter, the
+	// CORS middleware, the compression middleware, the request ID middleware (so that
+	// everything inside it can log the ID), the metrics middleware, so that every
+	// response is counted, and finally the panic recovery middleware, so that panics
+	// anywhere in the chain are recovered. The CORS middleware sits in front of the
+	// rate limiter so that rejected requests still carry the CORS headers the browser
+	// needs to read them.
+	return app.recoverPanic(app.metrics(app.requestID(app.compress(app.enableCORS(app.rateLimit(app.authenticate(app.headAsGet(router))))))))
 }
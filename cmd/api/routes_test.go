@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"delsanchez.gl/internal/data"
+)
+
+func TestNotFound(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app)
+
+	res := ts.Get("/v1/nothing-here", http.Header{"X-Request-Id": {"test-request-id"}})
+
+	res.AssertError(http.StatusNotFound, "the requested resource could not be found")
+	res.AssertGolden("not_found")
+}
+
+func TestMethodNotAllowed(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app)
+
+	res := ts.Do(http.MethodDelete, "/v1/healthcheck", nil, nil)
+
+	res.AssertError(http.StatusMethodNotAllowed, "the DELETE method is not supported for this resource.")
+
+	if got := res.Header.Get("Allow"); got != "GET, OPTIONS" {
+		t.Errorf("got Allow header %q; want %q", got, "GET, OPTIONS")
+	}
+}
+
+// httprouter doesn't send HEAD requests to the GET handlers by itself, so check that
+// they get there through the real router, and only for the routes which have them.
+func TestHead(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app)
+
+	err := app.models.Movies.Insert(context.Background(), &data.Movie{
+		Title:   "Casablanca",
+		Year:    1942,
+		Runtime: 102,
+		Genres:  []string{"drama", "romance", "war"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reader := app.authHeader(t, "movies:read")
+
+	get := ts.Get("/v1/movies/1", reader)
+	get.AssertStatus(http.StatusOK)
+
+	head := ts.Do(http.MethodHead, "/v1/movies/1", nil, reader)
+	head.AssertStatus(http.StatusOK)
+
+	if len(head.Body) != 0 {
+		t.Errorf("got body %q; want no body", head.Body)
+	}
+	if got, want := head.Header.Get("Content-Type"), get.Header.Get("Content-Type"); got != want {
+		t.Errorf("got Content-Type %q; want %q", got, want)
+	}
+	if got, want := head.Header.Get("Content-Length"), strconv.Itoa(len(get.Body)); got != want {
+		t.Errorf("got Content-Length %q; want %q", got, want)
+	}
+
+	// The handlers behind the GET route still check the permissions.
+	res := ts.Do(http.MethodHead, "/v1/movies/1", nil, nil)
+	res.AssertStatus(http.StatusUnauthorized)
+
+	// A route without a GET handler doesn't accept HEAD requests either.
+	res = ts.Do(http.MethodHead, "/v1/users", nil, nil)
+	res.AssertStatus(http.StatusMethodNotAllowed)
+}
+
+func TestMetricsEndpoint(t *testing.T) {
+	tests := []struct {
+		name       string
+		enabled    bool
+		wantStatus int
+	}{
+		{name: "Disabled by default", enabled: false, wantStatus: http.StatusNotFound},
+		{name: "Enabled", enabled: true, wantStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			app.config.metrics.enabled = tt.enabled
+			ts := newTestServer(t, app)
+
+			res := ts.Get("/debug/vars", nil)
+
+			res.AssertStatus(tt.wantStatus)
+		})
+	}
+}
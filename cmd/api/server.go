@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// serve() starts the HTTP server and blocks until it has been shut down. A SIGINT or
+// SIGTERM signal triggers a graceful shutdown: the server stops accepting new
+// connections, in-flight requests get up to the -shutdown-timeout grace period to
+// complete, and then we wait for any background goroutines to finish. serve() only
+// returns an error if something actually went wrong, so a clean shutdown returns nil.
+func (app *application) serve() error {
+	// Declare a HTTP server with sensible timeout settings, which listens on the port
+	// provided in the config struct and uses the httprouter instance returned by
+	// app.routes() as the handler.
+	// Any errors that http.Server logs itself are routed through our logger too, at
+	// the ERROR level.
+	srv := &http.Server{
+		Addr:         fmt.Sprintf(":%d", app.config.port),
+		Handler:      app.routes(),
+		ErrorLog:     log.New(app.logger, "", 0),
+		IdleTimeout:  time.Minute,
+		ReadTimeout:  10 * time.Second,
+		WriteTimeout: 30 * time.Second,
+	}
+
+	// Start the sweeper which removes old entries from the rate limiter's clients map.
+	// Closing done when serve() returns stops it, however the server stopped.
+	done := make(chan struct{})
+	defer close(done)
+
+	go app.sweepRateLimitClients(done)
+
+	// The shutdownError channel receives any errors returned by the graceful
+	// Shutdown() function.
+	shutdownError := make(chan error)
+
+	go func() {
+		// signal.Notify() needs a buffered channel, otherwise a signal could be
+		// missed if we aren't ready to receive it at the exact moment it's sent.
+		quit := make(chan os.Signal, 1)
+		signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+
+		// Block until a signal is received.
+		s := <-quit
+
+		app.logger.PrintInfo("shutting down server", map[string]string{
+			"signal":       s.String(),
+			"grace_period": app.config.shutdownTimeout.String(),
+		})
+
+		ctx, cancel := context.WithTimeout(context.Background(), app.config.shutdownTimeout)
+		defer cancel()
+
+		// Shutdown() returns nil if the graceful shutdown was successful, or an error
+		// (which may happen because of a problem closing the listeners, or because the
+		// shutdown didn't complete before the context deadline was hit).
+		err := srv.Shutdown(ctx)
+		if err != nil {
+			shutdownError <- err
+			return
+		}
+
+		// Wait for any background goroutines started with app.background() to
+		// complete their tasks.
+		app.logger.PrintInfo("completing background tasks", nil)
+		app.wg.Wait()
+
+		shutdownError <- nil
+	}()
+
+	app.logger.PrintInfo("starting server", map[string]string{
+		"addr": srv.Addr,
+		"env":  app.config.env,
+	})
+
+	// Calling Shutdown() on our server will cause ListenAndServe() to immediately
+	// return a http.ErrServerClosed error. So if we see this error, it is actually a
+	// good thing and an indication that the graceful shutdown has started. Anything
+	// else is a real failure to start the server.
+	err := srv.ListenAndServe()
+	if !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	// Otherwise, we wait to receive the return value from Shutdown() on the
+	// shutdownError channel.
+	err = <-shutdownError
+	if err != nil {
+		return err
+	}
+
+	app.logger.PrintInfo("stopped server", map[string]string{
+		"addr": srv.Addr,
+	})
+
+	return nil
+}
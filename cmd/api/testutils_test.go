@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"delsanchez.gl/internal/apitest"
+	"delsanchez.gl/internal/data"
+	"delsanchez.gl/internal/jsonlog"
+	"delsanchez.gl/internal/mailer"
+)
+
+// newTestApplication() returns an application with fake dependencies: in-memory
+// models, an in-memory mailer and a logger which throws everything away. The rate
+// limiter is left disabled so that tests can send as many requests as they like.
+func newTestApplication(t *testing.T) *application {
+	t.Helper()
+
+	var cfg config
+	cfg.env = "development"
+	cfg.storage = "memory"
+
+	return &application{
+		config: cfg,
+		logger: jsonlog.New(io.Discard, jsonlog.LevelOff, jsonlog.FormatJSON),
+		models: data.NewMemoryModels(),
+		mailer: mailer.NewMemory(),
+	}
+}
+
+// newTestServer() serves app.routes() with httptest.
+func newTestServer(t *testing.T, app *application) *apitest.Server {
+	t.Helper()
+	return apitest.NewServer(t, app.routes())
+}
+
+var testUserCount atomic.Int64
+
+// authHeader() creates an activated user with the given permissions and returns the
+// Authorization header for a new authentication token of theirs.
+func (app *application) authHeader(t *testing.T, permissions ...string) http.Header {
+	t.Helper()
+
+	n := testUserCount.Add(1)
+
+	user := &data.User{
+		Name:      fmt.Sprintf("Test User %d", n),
+		Email:     fmt.Sprintf("user%d@example.com", n),
+		Activated: true,
+	}
+
+	err := user.Password.Set("pa55word1234")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = app.models.Users.Insert(context.Background(), user)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = app.models.Permissions.AddForUser(context.Background(), user.ID, permissions...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := app.models.Tokens.New(context.Background(), user.ID, time.Hour, data.ScopeAuthentication)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return http.Header{"Authorization": {"Bearer " + token.Plaintext}}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"testing"
+
+	"delsanchez.gl/internal/data"
+	"delsanchez.gl/internal/mailer"
+)
+
+func TestRegisterUser(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app)
+
+	input := map[string]any{
+		"name":     "Alice Smith",
+		"email":    "alice@example.com",
+		"password": "pa55word",
+	}
+
+	t.Run("Valid", func(t *testing.T) {
+		res := ts.Do(http.MethodPost, "/v1/users", input, nil)
+
+		res.AssertStatus(http.StatusCreated)
+
+		var user data.User
+		res.Decode("user", &user)
+
+		permissions, err := app.models.Permissions.GetAllForUser(context.Background(), user.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(permissions, data.Permissions{"movies:read"}) {
+			t.Errorf("got permissions %q; want [movies:read]", permissions)
+		}
+
+		// Wait for the welcome email, which carries the activation token.
+		app.wg.Wait()
+
+		messages := app.mailer.(*mailer.MemoryMailer).Messages()
+		if len(messages) != 1 || messages[0].Recipient != "alice@example.com" {
+			t.Errorf("got messages %+v; want one to alice@example.com", messages)
+		}
+	})
+
+	t.Run("Duplicate email", func(t *testing.T) {
+		res := ts.Do(http.MethodPost, "/v1/users", input, nil)
+
+		res.AssertError(http.StatusUnprocessableEntity, map[string]string{
+			"email": "a user with this email address already exists",
+		})
+	})
+}
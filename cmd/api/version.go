@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"delsanchez.gl/internal/vcs"
+)
+
+// buildInfo describes the running binary.
+type buildInfo struct {
+	Version    string
+	BuildTime  string
+	Revision   string
+	CommitTime string
+	Modified   bool
+	GoVersion  string
+}
+
+// versionInfo() combines the values injected by the linker with the VCS details
+// recorded by the Go toolchain. If no version was injected, we use the module version
+// (for `go install`ed binaries) or else "dev", with a "-dirty" suffix if the binary
+// was built from a working tree with uncommitted changes.
+func versionInfo() buildInfo {
+	v := vcs.Read()
+
+	info := buildInfo{
+		Version:    version,
+		BuildTime:  buildTime,
+		Revision:   v.Revision,
+		CommitTime: v.CommitTime,
+		Modified:   v.Modified,
+		GoVersion:  v.GoVersion,
+	}
+
+	if info.Version == "" {
+		info.Version = vcs.ModuleVersion()
+	}
+	if info.Version == "" {
+		info.Version = "dev"
+		if info.Modified {
+			info.Version += "-dirty"
+		}
+	}
+
+	return info
+}
+
+// printVersion() writes the build details for the -version flag.
+func printVersion(out io.Writer) {
+	info := versionInfo()
+
+	fmt.Fprintf(out, "Version:\t%s\n", info.Version)
+	fmt.Fprintf(out, "Build time:\t%s\n", info.BuildTime)
+	fmt.Fprintf(out, "Revision:\t%s\n", info.Revision)
+	fmt.Fprintf(out, "Commit time:\t%s\n", info.CommitTime)
+	fmt.Fprintf(out, "Modified:\t%t\n", info.Modified)
+	fmt.Fprintf(out, "Go version:\t%s\n", info.GoVersion)
+}
@@ -5,3 +5,9 @@ go 1.22.0
 require github.com/julienschmidt/httprouter v1.3.0
 
 require github.com/lib/pq v1.10.2
+
+require golang.org/x/time v0.5.0
+
+require golang.org/x/crypto v0.21.0
+
+require github.com/andybalholm/brotli v1.2.0
@@ -0,0 +1,254 @@
+// Package apitest contains helpers for end-to-end tests of the HTTP API. It serves a
+// http.Handler (normally app.routes()) with httptest, sends JSON requests to it and
+// makes assertions about the JSON envelopes that come back.
+package apitest
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Run `go test ./cmd/api -update` to rewrite the golden files with the current
+// responses.
+var update = flag.Bool("update", false, "update the golden files")
+
+// A Server wraps a httptest.Server and the test which is using it.
+type Server struct {
+	*httptest.Server
+	t *testing.T
+}
+
+// NewServer() starts a test server for h, which is shut down automatically when the
+// test finishes.
+func NewServer(t *testing.T, h http.Handler) *Server {
+	t.Helper()
+
+	ts := httptest.NewServer(h)
+	t.Cleanup(ts.Close)
+
+	return &Server{Server: ts, t: t}
+}
+
+// A Response holds everything about a response that the tests look at. The body has
+// already been read in full.
+type Response struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+	t          *testing.T
+}
+
+// Do() sends a request to the test server. A string or []byte body is sent as-is
+// (so that malformed JSON can be tested), a nil body sends no body at all, and
+// anything else is encoded to JSON. The headers may be nil.
+func (s *Server) Do(method, path string, body any, headers http.Header) *Response {
+	s.t.Helper()
+
+	var reader io.Reader
+	switch body := body.(type) {
+	case nil:
+	case string:
+		reader = strings.NewReader(body)
+	case []byte:
+		reader = bytes.NewReader(body)
+	default:
+		js, err := json.Marshal(body)
+		if err != nil {
+			s.t.Fatal(err)
+		}
+		reader = bytes.NewReader(js)
+	}
+
+	req, err := http.NewRequest(method, s.URL+path, reader)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	for key, values := range headers {
+		req.Header[key] = values
+	}
+	if reader != nil && req.Header.Get("Content-Type") == "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	res, err := s.Client().Do(req)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	resBody, err := io.ReadAll(res.Body)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+
+	return &Response{
+		StatusCode: res.StatusCode,
+		Header:     res.Header,
+		Body:       resBody,
+		t:          s.t,
+	}
+}
+
+// Get() is a shortcut for a GET request without a body.
+func (s *Server) Get(path string, headers http.Header) *Response {
+	s.t.Helper()
+	return s.Do(http.MethodGet, path, nil, headers)
+}
+
+// AssertStatus() fails the test if the response doesn't have the wanted status code.
+func (r *Response) AssertStatus(want int) {
+	r.t.Helper()
+
+	if r.StatusCode != want {
+		r.t.Fatalf("got status %d; want %d\nbody: %s", r.StatusCode, want, r.Body)
+	}
+}
+
+// Envelope() decodes the top-level JSON object of the response body.
+func (r *Response) Envelope() map[string]json.RawMessage {
+	r.t.Helper()
+
+	var env map[string]json.RawMessage
+
+	err := json.Unmarshal(r.Body, &env)
+	if err != nil {
+		r.t.Fatalf("unable to decode response envelope: %v\nbody: %s", err, r.Body)
+	}
+	return env
+}
+
+// Decode() decodes the value under key in the response envelope into dst.
+func (r *Response) Decode(key string, dst any) {
+	r.t.Helper()
+
+	raw, ok := r.Envelope()[key]
+	if !ok {
+		r.t.Fatalf("response envelope has no %q key\nbody: %s", key, r.Body)
+	}
+
+	err := json.Unmarshal(raw, dst)
+	if err != nil {
+		r.t.Fatalf("unable to decode %q: %v\nbody: %s", key, err, r.Body)
+	}
+}
+
+// AssertError() checks the status code, and that the "error" value of the response
+// envelope equals want. For a plain error message want is a string, and for a
+// validation failure it is a map[string]string of the field errors.
+func (r *Response) AssertError(status int, want any) {
+	r.t.Helper()
+
+	r.AssertStatus(status)
+
+	var got any
+	switch want.(type) {
+	case string:
+		var message string
+		r.Decode("error", &message)
+		got = message
+	case map[string]string:
+		var errors map[string]string
+		r.Decode("error", &errors)
+		got = errors
+	default:
+		r.t.Fatalf("AssertError: unsupported type %T for want", want)
+	}
+
+	gotJS, _ := json.Marshal(got)
+	wantJS, _ := json.Marshal(want)
+	if !bytes.Equal(gotJS, wantJS) {
+		r.t.Fatalf("got error %s; want %s", gotJS, wantJS)
+	}
+}
+
+// AssertGolden() compares the response body with testdata/<name>.golden. The values
+// of any JSON object keys listed in scrub (at any depth) are replaced with "<scrubbed>"
+// first, which is how values that change between runs, like timestamps, are left out
+// of the comparison.
+func (r *Response) AssertGolden(name string, scrub ...string) {
+	r.t.Helper()
+
+	got := r.Body
+	if len(scrub) > 0 {
+		got = Scrub(r.t, got, scrub...)
+	}
+
+	path := filepath.Join("testdata", name+".golden")
+
+	if *update {
+		err := os.MkdirAll("testdata", 0o755)
+		if err != nil {
+			r.t.Fatal(err)
+		}
+		err = os.WriteFile(path, got, 0o644)
+		if err != nil {
+			r.t.Fatal(err)
+		}
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		r.t.Fatalf("%v (run the tests with -update to create it)", err)
+	}
+
+	if !bytes.Equal(got, want) {
+		r.t.Fatalf("response doesn't match %s\n--- got:\n%s\n--- want:\n%s", path, got, want)
+	}
+}
+
+// Scrub() replaces the values of the given keys in a JSON document with "<scrubbed>",
+// and re-encodes it in the same tab-indented style that writeResponse() uses.
+func Scrub(t *testing.T, js []byte, keys ...string) []byte {
+	t.Helper()
+
+	var doc any
+
+	err := json.Unmarshal(js, &doc)
+	if err != nil {
+		t.Fatalf("unable to decode JSON: %v\n%s", err, js)
+	}
+
+	scrubKeys := make(map[string]bool)
+	for _, key := range keys {
+		scrubKeys[key] = true
+	}
+
+	var walk func(v any)
+	walk = func(v any) {
+		switch v := v.(type) {
+		case map[string]any:
+			for key, value := range v {
+				if scrubKeys[key] {
+					v[key] = "<scrubbed>"
+					continue
+				}
+				walk(value)
+			}
+		case []any:
+			for _, value := range v {
+				walk(value)
+			}
+		}
+	}
+	walk(doc)
+
+	var out bytes.Buffer
+
+	enc := json.NewEncoder(&out)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "\t")
+
+	err = enc.Encode(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out.Bytes()
+}
@@ -0,0 +1,467 @@
+package data
+
+import (
+	"context"
+	"crypto/sha256"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// memoryDB holds the records for the in-memory models. All of the in-memory models
+// returned by NewMemoryModels() share one memoryDB (just like the PostgreSQL models
+// share one database), so that, for example, GetForToken() can see the tokens created
+// through the TokenStore. Records are stored by value and copied on the way in and
+// out, so callers can never modify the stored data without going through Update().
+type memoryDB struct {
+	mu          sync.RWMutex
+	movies      map[int64]Movie
+	lastMovieID int64
+	users       map[int64]User
+	lastUserID  int64
+	tokens      map[string]Token
+	permissions map[int64]Permissions
+}
+
+// NewMemoryModels() returns a Models struct backed by in-memory, concurrency-safe
+// models. Nothing is persisted, so this is only meant for development and tests.
+// The in-memory models never time out, but like the PostgreSQL models they return
+// ctx.Err() if the context is already done when they're called.
+func NewMemoryModels() Models {
+	db := &memoryDB{
+		movies:      make(map[int64]Movie),
+		users:       make(map[int64]User),
+		tokens:      make(map[string]Token),
+		permissions: make(map[int64]Permissions),
+	}
+
+	return Models{
+		Movies:      MemoryMovieModel{db: db},
+		Permissions: MemoryPermissionModel{db: db},
+		Tokens:      MemoryTokenModel{db: db},
+		Users:       MemoryUserModel{db: db},
+	}
+}
+
+// now() mirrors the timestamp(0) columns, which only store whole seconds.
+func now() time.Time {
+	return time.Now().Truncate(time.Second)
+}
+
+func copyMovie(movie Movie) *Movie {
+	movie.Genres = slices.Clone(movie.Genres)
+	return &movie
+}
+
+// An in-memory implementation of MovieStore.
+type MemoryMovieModel struct {
+	db *memoryDB
+}
+
+func (m MemoryMovieModel) Insert(ctx context.Context, movie *Movie) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	m.db.lastMovieID++
+
+	movie.ID = m.db.lastMovieID
+	movie.CreatedAt = now()
+	movie.Version = 1
+
+	m.db.movies[movie.ID] = *copyMovie(*movie)
+	return nil
+}
+
+func (m MemoryMovieModel) Get(ctx context.Context, id int64) (*Movie, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.db.mu.RLock()
+	defer m.db.mu.RUnlock()
+
+	movie, ok := m.db.movies[id]
+	if !ok {
+		return nil, ErrRecordNotFound
+	}
+	return copyMovie(movie), nil
+}
+
+// GetAll() filters, sorts and pages the movies the same way as the SQL query in
+// MovieModel.GetAll(), including its quirks: title matching works on whole
+// (case-insensitive) words in any order. Sorting by title follows compareTitles().
+func (m MemoryMovieModel) GetAll(ctx context.Context, title string, genres []string, filters Filters) ([]*Movie, Metadata, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+	column, direction := filters.sortColumn(), filters.sortDirection()
+	titleWords := words(title)
+
+	m.db.mu.RLock()
+
+	var matches []*Movie
+	for _, movie := range m.db.movies {
+		// A title without any words (e.g. "!!") produces an empty tsquery in
+		// PostgreSQL, which doesn't match anything.
+		if title != "" && (len(titleWords) == 0 || !containsAll(words(movie.Title), titleWords)) {
+			continue
+		}
+		if !containsAll(movie.Genres, genres) {
+			continue
+		}
+		matches = append(matches, copyMovie(movie))
+	}
+
+	m.db.mu.RUnlock()
+
+	sort.Slice(matches, func(i, j int) bool {
+		a, b := matches[i], matches[j]
+
+		var cmp int
+		switch column {
+		case "title":
+			cmp = compareTitles(a.Title, b.Title)
+		case "year":
+			cmp = compare(a.Year, b.Year)
+		case "runtime":
+			cmp = compare(a.Runtime, b.Runtime)
+		}
+		if direction == "DESC" {
+			cmp = -cmp
+		}
+
+		// Use the ID as the secondary sort, always ascending, like the SQL query.
+		if cmp == 0 {
+			if column == "id" && direction == "DESC" {
+				return a.ID > b.ID
+			}
+			return a.ID < b.ID
+		}
+		return cmp < 0
+	})
+
+	movies := []*Movie{}
+	if offset := filters.offset(); offset < len(matches) {
+		movies = matches[offset:min(offset+filters.limit(), len(matches))]
+	}
+
+	return movies, calculateMetadata(len(matches), filters.Page, filters.PageSize), nil
+}
+
+func (m MemoryMovieModel) Update(ctx context.Context, movie *Movie) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	// Like the SQL UPDATE, a missing record or a version mismatch both mean that
+	// no rows matched, which is reported as an edit conflict.
+	stored, ok := m.db.movies[movie.ID]
+	if !ok || stored.Version != movie.Version {
+		return ErrEditConflict
+	}
+
+	movie.Version++
+	stored.Title = movie.Title
+	stored.Year = movie.Year
+	stored.Runtime = movie.Runtime
+	stored.Genres = slices.Clone(movie.Genres)
+	stored.Version = movie.Version
+
+	m.db.movies[movie.ID] = stored
+	return nil
+}
+
+func (m MemoryMovieModel) Delete(ctx context.Context, id int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	if _, ok := m.db.movies[id]; !ok {
+		return ErrRecordNotFound
+	}
+
+	delete(m.db.movies, id)
+	return nil
+}
+
+// words() splits s into lower-cased words, roughly like PostgreSQL's 'simple' text
+// search configuration.
+func words(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// containsAll() reports whether every value in want appears in have, like the
+// PostgreSQL @> array operator.
+func containsAll(have, want []string) bool {
+	for _, w := range want {
+		if !slices.Contains(have, w) {
+			return false
+		}
+	}
+	return true
+}
+
+// compareTitles() orders titles the way PostgreSQL does with the usual en_US.UTF-8
+// database collation, rather than byte by byte: case is ignored, so "alien" sorts
+// before "Batman", and titles which only differ in case are ordered lowercase first.
+// Unlike the collation, it doesn't ignore accents or punctuation, so titles which
+// only differ in those can still sort differently from PostgreSQL.
+func compareTitles(a, b string) int {
+	if cmp := strings.Compare(strings.ToLower(a), strings.ToLower(b)); cmp != 0 {
+		return cmp
+	}
+	// Lowercase letters come after their uppercase ones in byte order.
+	return strings.Compare(b, a)
+}
+
+func compare[T int32 | Runtime](a, b T) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// An in-memory implementation of UserStore. Emails are compared case-insensitively,
+// like the citext column.
+type MemoryUserModel struct {
+	db *memoryDB
+}
+
+func (m MemoryUserModel) emailTaken(email string, exceptID int64) bool {
+	for id, user := range m.db.users {
+		if id != exceptID && strings.EqualFold(user.Email, email) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m MemoryUserModel) Insert(ctx context.Context, user *User) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	return m.insert(user)
+}
+
+// insert() adds the user to the store. The caller must hold the write lock.
+func (m MemoryUserModel) insert(user *User) error {
+	if m.emailTaken(user.Email, 0) {
+		return ErrDuplicateEmail
+	}
+
+	m.db.lastUserID++
+
+	user.ID = m.db.lastUserID
+	user.CreatedAt = now()
+	user.Version = 1
+
+	// Like the users table, only keep the password hash.
+	stored := *user
+	stored.Password.plaintext = nil
+
+	m.db.users[user.ID] = stored
+	return nil
+}
+
+// Register() does the same as UserModel.Register(), holding the lock throughout so
+// that the other models never see a half-registered user.
+func (m MemoryUserModel) Register(ctx context.Context, user *User, activationTTL time.Duration, permissions ...string) (*Token, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	err := m.insert(user)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := generateToken(user.ID, activationTTL, ScopeActivation)
+	if err != nil {
+		// Roll back the insert.
+		delete(m.db.users, user.ID)
+		m.db.lastUserID--
+		return nil, err
+	}
+
+	MemoryPermissionModel(m).add(user.ID, permissions...)
+	MemoryTokenModel(m).insert(token)
+
+	return token, nil
+}
+
+func (m MemoryUserModel) GetByEmail(ctx context.Context, email string) (*User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.db.mu.RLock()
+	defer m.db.mu.RUnlock()
+
+	for _, user := range m.db.users {
+		if strings.EqualFold(user.Email, email) {
+			return &user, nil
+		}
+	}
+	return nil, ErrRecordNotFound
+}
+
+func (m MemoryUserModel) Update(ctx context.Context, user *User) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	if m.emailTaken(user.Email, user.ID) {
+		return ErrDuplicateEmail
+	}
+
+	stored, ok := m.db.users[user.ID]
+	if !ok || stored.Version != user.Version {
+		return ErrEditConflict
+	}
+
+	user.Version++
+	stored = *user
+	stored.Password.plaintext = nil
+
+	m.db.users[user.ID] = stored
+	return nil
+}
+
+func (m MemoryUserModel) GetForToken(ctx context.Context, tokenScope, tokenPlaintext string) (*User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+
+	m.db.mu.RLock()
+	defer m.db.mu.RUnlock()
+
+	token, ok := m.db.tokens[string(tokenHash[:])]
+	if !ok || token.Scope != tokenScope || !token.Expiry.After(time.Now()) {
+		return nil, ErrRecordNotFound
+	}
+
+	user, ok := m.db.users[token.UserID]
+	if !ok {
+		return nil, ErrRecordNotFound
+	}
+	return &user, nil
+}
+
+// An in-memory implementation of TokenStore. Only the token hash is kept, and the
+// tokens are keyed by it.
+type MemoryTokenModel struct {
+	db *memoryDB
+}
+
+func (m MemoryTokenModel) New(ctx context.Context, userID int64, ttl time.Duration, scope string) (*Token, error) {
+	token, err := generateToken(userID, ttl, scope)
+	if err != nil {
+		return nil, err
+	}
+
+	err = m.Insert(ctx, token)
+	return token, err
+}
+
+func (m MemoryTokenModel) Insert(ctx context.Context, token *Token) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	if _, ok := m.db.users[token.UserID]; !ok {
+		return ErrRecordNotFound
+	}
+
+	m.insert(token)
+	return nil
+}
+
+// insert() adds the token to the store. The caller must hold the write lock.
+func (m MemoryTokenModel) insert(token *Token) {
+	stored := *token
+	stored.Plaintext = ""
+	stored.Hash = slices.Clone(token.Hash)
+
+	m.db.tokens[string(token.Hash)] = stored
+}
+
+func (m MemoryTokenModel) DeleteAllForUser(ctx context.Context, scope string, userID int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	for hash, token := range m.db.tokens {
+		if token.Scope == scope && token.UserID == userID {
+			delete(m.db.tokens, hash)
+		}
+	}
+	return nil
+}
+
+// An in-memory implementation of PermissionStore. Only the permission codes created
+// by the migrations are known.
+type MemoryPermissionModel struct {
+	db *memoryDB
+}
+
+var knownPermissions = []string{"movies:read", "movies:write"}
+
+func (m MemoryPermissionModel) GetAllForUser(ctx context.Context, userID int64) (Permissions, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.db.mu.RLock()
+	defer m.db.mu.RUnlock()
+
+	return slices.Clone(m.db.permissions[userID]), nil
+}
+
+func (m MemoryPermissionModel) AddForUser(ctx context.Context, userID int64, codes ...string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	if _, ok := m.db.users[userID]; !ok {
+		return ErrRecordNotFound
+	}
+
+	m.add(userID, codes...)
+	return nil
+}
+
+// add() grants the permissions to the user. The caller must hold the write lock.
+func (m MemoryPermissionModel) add(userID int64, codes ...string) {
+	for _, code := range codes {
+		if slices.Contains(knownPermissions, code) && !m.db.permissions[userID].Include(code) {
+			m.db.permissions[userID] = append(m.db.permissions[userID], code)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package data
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+)
+
+// The in-memory store must only keep the password hash, like the users table, however
+// the user got there.
+func TestMemoryUserModelPasswords(t *testing.T) {
+	models := NewMemoryModels()
+	db := models.Users.(MemoryUserModel).db
+
+	newUser := func(email string) *User {
+		user := &User{Name: "Alice", Email: email}
+
+		err := user.Password.Set("pa55word")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return user
+	}
+
+	inserted := newUser("alice@example.com")
+	err := models.Users.Insert(context.Background(), inserted)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	registered := newUser("bob@example.com")
+	_, err = models.Users.Register(context.Background(), registered, time.Hour, "movies:read")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, user := range []*User{inserted, registered} {
+		stored := db.users[user.ID]
+
+		if stored.Password.plaintext != nil {
+			t.Errorf("%s: the plaintext password was stored", user.Email)
+		}
+		if match, err := stored.Password.Matches("pa55word"); err != nil || !match {
+			t.Errorf("%s: got Matches() = %t, %v; want true", user.Email, match, err)
+		}
+	}
+}
+
+// The title sort must match the order PostgreSQL gives with an en_US.UTF-8 database,
+// which ignores case, rather than the byte order.
+func TestMemoryMovieModelSortByTitle(t *testing.T) {
+	models := NewMemoryModels()
+
+	for _, title := range []string{"Zorro", "the Club", "Batman", "alien", "The Godfather", "batman"} {
+		err := models.Movies.Insert(context.Background(), &Movie{Title: title, Year: 2000, Runtime: 100, Genres: []string{"drama"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		sort string
+		want []string
+	}{
+		{sort: "title", want: []string{"alien", "batman", "Batman", "the Club", "The Godfather", "Zorro"}},
+		{sort: "-title", want: []string{"Zorro", "The Godfather", "the Club", "Batman", "batman", "alien"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.sort, func(t *testing.T) {
+			filters := Filters{Page: 1, PageSize: 20, Sort: tt.sort, SortSafelist: []string{"title", "-title"}}
+
+			movies, _, err := models.Movies.GetAll(context.Background(), "", nil, filters)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := make([]string, len(movies))
+			for i, movie := range movies {
+				got[i] = movie.Title
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Define a custom ErrRecordNotFound error. We'll return this from the Get() method
+// (and friends) when looking up a movie that doesn't exist in our database.
+// ErrEditConflict is returned by Update() when the record was changed by someone
+// else after we read it (see the version check in MovieModel.Update()).
+var (
+	ErrRecordNotFound = errors.New("record not found")
+	ErrEditConflict   = errors.New("edit conflict")
+)
+
+// The handlers only depend on these interfaces, rather than on the PostgreSQL models
+// directly, so that the storage backend can be swapped out. Each one is implemented
+// by the PostgreSQL model (e.g. MovieModel) and by an in-memory version (see
+// memory.go), and both must behave the same way, including the errors they return.
+// Every method takes the context of the request it's working for, so that the query
+// is abandoned when the client goes away. If that happens, or the query takes longer
+// than the model's timeout, the error wraps context.Canceled or
+// context.DeadlineExceeded.
+type MovieStore interface {
+	Insert(ctx context.Context, movie *Movie) error
+	Get(ctx context.Context, id int64) (*Movie, error)
+	GetAll(ctx context.Context, title string, genres []string, filters Filters) ([]*Movie, Metadata, error)
+	Update(ctx context.Context, movie *Movie) error
+	Delete(ctx context.Context, id int64) error
+}
+
+type PermissionStore interface {
+	GetAllForUser(ctx context.Context, userID int64) (Permissions, error)
+	AddForUser(ctx context.Context, userID int64, codes ...string) error
+}
+
+type TokenStore interface {
+	New(ctx context.Context, userID int64, ttl time.Duration, scope string) (*Token, error)
+	Insert(ctx context.Context, token *Token) error
+	DeleteAllForUser(ctx context.Context, scope string, userID int64) error
+}
+
+type UserStore interface {
+	Insert(ctx context.Context, user *User) error
+	Register(ctx context.Context, user *User, activationTTL time.Duration, permissions ...string) (*Token, error)
+	GetByEmail(ctx context.Context, email string) (*User, error)
+	Update(ctx context.Context, user *User) error
+	GetForToken(ctx context.Context, tokenScope, tokenPlaintext string) (*User, error)
+}
+
+// A Models struct which wraps all of our models.
+type Models struct {
+	Movies      MovieStore
+	Permissions PermissionStore
+	Tokens      TokenStore
+	Users       UserStore
+}
+
+// For ease of use, a NewModels() method which returns a Models struct
+// containing the initialized PostgreSQL models. Each query they run is given at most
+// queryTimeout to complete.
+func NewModels(db *sql.DB, queryTimeout time.Duration) Models {
+	return Models{
+		Movies:      MovieModel{DB: db, Timeout: queryTimeout},
+		Permissions: PermissionModel{DB: db, Timeout: queryTimeout},
+		Tokens:      TokenModel{DB: db, Timeout: queryTimeout},
+		Users:       UserModel{DB: db, Timeout: queryTimeout},
+	}
+}
+
+// A querier is the part of *sql.DB that the PostgreSQL models use. *sql.Tx has the
+// same methods, so a query written against a querier can run on its own or as one
+// step of a transaction (see UserModel.Register()).
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// contextError() makes sure that a failed query's error wraps ctx.Err() when the query
+// failed because ctx was canceled or timed out, so that the caller can tell with
+// errors.Is(). Depending on when the context is done, database/sql may return ctx.Err()
+// itself, but lib/pq returns its own "canceling statement due to user request" error.
+func contextError(ctx context.Context, err error) error {
+	if err == nil || ctx.Err() == nil || errors.Is(err, ctx.Err()) {
+		return err
+	}
+	return fmt.Errorf("%w: %w", ctx.Err(), err)
+}
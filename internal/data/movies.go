@@ -1,9 +1,14 @@
 package data
 
 import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
 	"time"
 
 	"delsanchez.gl/internal/validator"
+	"github.com/lib/pq"
 )
 
 type Movie struct {
@@ -33,3 +38,222 @@ func ValidateMovie(v *validator.Validator, movie *Movie) {
 	v.Check(len(movie.Genres) <= 5, "genres", "must not contain more than 5 genres")
 	v.Check(validator.Unique(movie.Genres), "genres", "must not contain duplicate values")
 }
+
+// A MovieModel struct type which wraps a sql.DB connection pool, and the time limit for
+// each query.
+type MovieModel struct {
+	DB      *sql.DB
+	Timeout time.Duration
+}
+
+// Insert() accepts a pointer to a movie struct, which should contain the data for the
+// new record. The id, created_at and version columns are all generated by the
+// database, so we read them back with the RETURNING clause and write them into the
+// movie struct.
+func (m MovieModel) Insert(ctx context.Context, movie *Movie) error {
+	query := `
+		INSERT INTO movies (title, year, runtime, genres)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at, version`
+
+	// The pq.Array() adapter converts the []string genres slice to a type that
+	// can be stored in a PostgreSQL text[] column.
+	args := []any{movie.Title, movie.Year, movie.Runtime, pq.Array(movie.Genres)}
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&movie.ID, &movie.CreatedAt, &movie.Version)
+	return contextError(ctx, err)
+}
+
+// Get() fetches a specific movie record. If no matching record is found, it returns
+// the ErrRecordNotFound error.
+func (m MovieModel) Get(ctx context.Context, id int64) (*Movie, error) {
+	// The PostgreSQL bigserial type starts auto-incrementing at 1 by default,
+	// so no movies will have an ID value less than that. Avoid an unnecessary
+	// database call by returning early.
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		SELECT id, created_at, title, year, runtime, genres, version
+		FROM movies
+		WHERE id = $1`
+
+	var movie Movie
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	// Note the use of pq.Array() again, this time to scan the text[] column
+	// back into the []string Genres field.
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&movie.ID,
+		&movie.CreatedAt,
+		&movie.Title,
+		&movie.Year,
+		&movie.Runtime,
+		pq.Array(&movie.Genres),
+		&movie.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, contextError(ctx, err)
+		}
+	}
+
+	return &movie, nil
+}
+
+// GetAll() returns a slice of movies matching the title and genres filters, sorted and
+// paginated according to the Filters struct, along with the pagination metadata.
+// An empty title or genres value means "don't filter on this".
+func (m MovieModel) GetAll(ctx context.Context, title string, genres []string, filters Filters) ([]*Movie, Metadata, error) {
+	// The title is matched using PostgreSQL full-text search, so a title of "the club"
+	// matches "The Breakfast Club". The @> operator checks that the genres column
+	// contains all of the requested genres. The count(*) OVER() window function gives
+	// us the total number of matching records alongside each row, which we need for
+	// the metadata (a page past the end has no rows, so then we count the matching
+	// records separately). The sort column and direction can't be query placeholders,
+	// so they are interpolated (sortColumn() makes sure they come from the safelist),
+	// and id is always used as a secondary sort to keep the ordering stable between
+	// pages.
+	where := `
+		WHERE (to_tsvector('simple', title) @@ plainto_tsquery('simple', $1) OR $1 = '')
+		AND (genres @> $2 OR $2 = '{}')`
+
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), id, created_at, title, year, runtime, genres, version
+		FROM movies %s
+		ORDER BY %s %s, id ASC
+		LIMIT $3 OFFSET $4`, where, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	args := []any{title, pq.Array(genres), filters.limit(), filters.offset()}
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, contextError(ctx, err)
+	}
+	// Importantly, defer a call to rows.Close() to ensure that the resultset is closed
+	// before GetAll() returns.
+	defer rows.Close()
+
+	totalRecords := 0
+	movies := []*Movie{}
+
+	for rows.Next() {
+		var movie Movie
+
+		err := rows.Scan(
+			&totalRecords,
+			&movie.ID,
+			&movie.CreatedAt,
+			&movie.Title,
+			&movie.Year,
+			&movie.Runtime,
+			pq.Array(&movie.Genres),
+			&movie.Version,
+		)
+		if err != nil {
+			return nil, Metadata{}, contextError(ctx, err)
+		}
+
+		movies = append(movies, &movie)
+	}
+
+	// When the rows.Next() loop has finished, call rows.Err() to retrieve any error
+	// that was encountered during the iteration.
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, contextError(ctx, err)
+	}
+
+	// If the page is past the end, there were no rows to read the total from, but the
+	// client still needs the metadata to know where the last page is.
+	if len(movies) == 0 && filters.offset() > 0 {
+		err = m.DB.QueryRowContext(ctx, "SELECT count(*) FROM movies"+where, title, pq.Array(genres)).Scan(&totalRecords)
+		if err != nil {
+			return nil, Metadata{}, contextError(ctx, err)
+		}
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return movies, metadata, nil
+}
+
+// Update() writes the title, year, runtime and genres of a movie back to the database
+// and increments its version number. The new version is scanned into the movie struct.
+// The update is only applied if the version in the database still matches the version
+// in the movie struct (i.e. the one we read earlier). If another request changed the
+// record in the meantime, no rows match and we return an ErrEditConflict error.
+func (m MovieModel) Update(ctx context.Context, movie *Movie) error {
+	query := `
+		UPDATE movies
+		SET title = $1, year = $2, runtime = $3, genres = $4, version = version + 1
+		WHERE id = $5 AND version = $6
+		RETURNING version`
+
+	args := []any{
+		movie.Title,
+		movie.Year,
+		movie.Runtime,
+		pq.Array(movie.Genres),
+		movie.ID,
+		movie.Version,
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&movie.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return contextError(ctx, err)
+		}
+	}
+
+	return nil
+}
+
+// Delete() removes a specific movie record. If no rows were affected, we know that
+// the movies table didn't contain a record with the provided ID at the moment we
+// tried to delete it, so we return an ErrRecordNotFound error.
+func (m MovieModel) Delete(ctx context.Context, id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+		DELETE FROM movies
+		WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return contextError(ctx, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return contextError(ctx, err)
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,30 @@
+package data
+
+import "encoding/json"
+
+// Optional is a wrapper for the fields of a partial update request. A plain pointer
+// can tell us whether a field was sent, but not whether the client sent an explicit
+// null, so Optional keeps track of both:
+//
+//	{}                    Set == false
+//	{"year": null}        Set == true, Null == true
+//	{"year": 1999}        Set == true, Null == false, Value == 1999
+type Optional[T any] struct {
+	Value T
+	Set   bool
+	Null  bool
+}
+
+// UnmarshalJSON() is only called by the decoder when the key is present in the JSON,
+// so reaching it at all means the field was set. Note that the decoder also calls it
+// for a literal null (rather than leaving the field alone) because Optional is a struct.
+func (o *Optional[T]) UnmarshalJSON(jsonValue []byte) error {
+	o.Set = true
+
+	if string(jsonValue) == "null" {
+		o.Null = true
+		return nil
+	}
+
+	return json.Unmarshal(jsonValue, &o.Value)
+}
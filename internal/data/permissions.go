@@ -0,0 +1,89 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Define a Permissions slice, which we will use to hold the permission codes (like
+// "movies:read" and "movies:write") for a single user.
+type Permissions []string
+
+// Add a helper method to check whether the Permissions slice contains a specific
+// permission code.
+func (p Permissions) Include(code string) bool {
+	for i := range p {
+		if code == p[i] {
+			return true
+		}
+	}
+	return false
+}
+
+// A PermissionModel struct type which wraps a sql.DB connection pool, and the time limit for
+// each query.
+type PermissionModel struct {
+	DB      *sql.DB
+	Timeout time.Duration
+}
+
+// The GetAllForUser() method returns all permission codes for a specific user in a
+// Permissions slice.
+func (m PermissionModel) GetAllForUser(ctx context.Context, userID int64) (Permissions, error) {
+	query := `
+		SELECT permissions.code
+		FROM permissions
+		INNER JOIN user_permissions ON user_permissions.permission_id = permissions.id
+		INNER JOIN users ON user_permissions.user_id = users.id
+		WHERE users.id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, contextError(ctx, err)
+	}
+	defer rows.Close()
+
+	var permissions Permissions
+
+	for rows.Next() {
+		var permission string
+
+		err := rows.Scan(&permission)
+		if err != nil {
+			return nil, contextError(ctx, err)
+		}
+
+		permissions = append(permissions, permission)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, contextError(ctx, err)
+	}
+
+	return permissions, nil
+}
+
+// Add the provided permission codes for a specific user. Notice that we're using a
+// variadic parameter for the codes so that we can assign multiple permissions in a
+// single call. Granting a permission the user already has is a no-op.
+func (m PermissionModel) AddForUser(ctx context.Context, userID int64, codes ...string) error {
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	return addPermissionsForUser(ctx, m.DB, userID, codes...)
+}
+
+func addPermissionsForUser(ctx context.Context, q querier, userID int64, codes ...string) error {
+	query := `
+		INSERT INTO user_permissions
+		SELECT $1, permissions.id FROM permissions WHERE permissions.code = ANY($2)
+		ON CONFLICT DO NOTHING`
+
+	_, err := q.ExecContext(ctx, query, userID, pq.Array(codes))
+	return contextError(ctx, err)
+}
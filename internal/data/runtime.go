@@ -1,62 +1,322 @@
 package data
 
 import (
+	"database/sql/driver"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"math"
+	"regexp"
 	"strconv"
 	"strings"
 )
 
-// Define an error that the UnmarshalJSON() method can return if we're
-// unable to parse or convert the JSON string successfully.
-var ErrInvalidRuntimeFormat = errors.New("invalid runtime format")
+// Define the errors that ParseRuntime() (and so the UnmarshalJSON() method) can return.
+// ErrInvalidRuntimeFormat means the value isn't in any of the accepted formats at all,
+// while the others say what is wrong with a value which is.
+var (
+	ErrInvalidRuntimeFormat   = errors.New("invalid runtime format")
+	ErrNegativeRuntime        = errors.New("runtime must not be negative")
+	ErrRuntimeOverflow        = fmt.Errorf("runtime must not be more than %d mins", math.MaxInt32)
+	ErrRuntimeNotWholeMinutes = errors.New("runtime must be a whole number of minutes")
+)
 
 // Declare a custom Runtime type, which has the type int32
-// same as the Movie struct field.
+// same as the Movie struct field. It's the runtime of a movie in minutes.
 type Runtime int32
 
+// The regular expressions for the accepted runtime formats (see ParseRuntime()). The
+// Go duration format only allows whole hours, minutes and seconds, and is case
+// sensitive, so that "1H42M" isn't mistaken for a broken ISO 8601 duration.
+var (
+	runtimeMinsRX     = regexp.MustCompile(`^(?i)(\d+) ?(?:mins?|minutes?)$`)
+	runtimeNumberRX   = regexp.MustCompile(`^(\d+)$`)
+	runtimeDurationRX = regexp.MustCompile(`^(?:(\d+)h)?(?:(\d+)m)?(?:(\d+)s)?$`)
+	runtimeISO8601RX  = regexp.MustCompile(`^(?i)P(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+)S)?)?$`)
+)
+
+// ParseRuntime() converts a runtime in any of these formats to a Runtime:
+//
+//	"102 mins", "1 min", "102 minutes"   a number of minutes, with a unit
+//	"102"                                a plain number of minutes
+//	"1h42m", "90m", "6120s"              a Go-style duration in whole h, m and s units
+//	"PT1H42M", "PT102M", "P1DT2H"        an ISO 8601 duration, without years, months or weeks
+//
+// Seconds are allowed as long as they add up to whole minutes. A leading minus sign
+// gives ErrNegativeRuntime, and a runtime which doesn't fit in an int32 number of
+// minutes gives ErrRuntimeOverflow.
+func ParseRuntime(s string) (Runtime, error) {
+	s = strings.TrimSpace(s)
+
+	// Parse the rest of a negative runtime anyway, so that "-foo" is still reported as
+	// an invalid format.
+	if rest, ok := strings.CutPrefix(s, "-"); ok {
+		_, err := ParseRuntime(rest)
+		if err == nil || errors.Is(err, ErrRuntimeOverflow) || errors.Is(err, ErrRuntimeNotWholeMinutes) {
+			return 0, ErrNegativeRuntime
+		}
+		return 0, err
+	}
+
+	// Each format is converted to a number of days, hours, minutes and seconds.
+	var parts [4]string
+
+	switch {
+	case s == "":
+		return 0, ErrInvalidRuntimeFormat
+	case runtimeMinsRX.MatchString(s):
+		parts[2] = runtimeMinsRX.FindStringSubmatch(s)[1]
+	case runtimeNumberRX.MatchString(s):
+		parts[2] = s
+	case runtimeDurationRX.MatchString(s):
+		m := runtimeDurationRX.FindStringSubmatch(s)
+		parts = [4]string{"", m[1], m[2], m[3]}
+	case runtimeISO8601RX.MatchString(s):
+		m := runtimeISO8601RX.FindStringSubmatch(s)
+		parts = [4]string{m[1], m[2], m[3], m[4]}
+		// "P" and "PT" on their own match the pattern, but don't have any components.
+		if parts == [4]string{} {
+			return 0, ErrInvalidRuntimeFormat
+		}
+	default:
+		return 0, ErrInvalidRuntimeFormat
+	}
+
+	var seconds int64
+
+	for i, unit := range []int64{24 * 60 * 60, 60 * 60, 60, 1} {
+		if parts[i] == "" {
+			continue
+		}
+
+		n, err := strconv.ParseInt(parts[i], 10, 64)
+		if err != nil || n > (math.MaxInt64-seconds)/unit {
+			return 0, ErrRuntimeOverflow
+		}
+
+		seconds += n * unit
+	}
+
+	if seconds%60 != 0 {
+		return 0, ErrRuntimeNotWholeMinutes
+	}
+
+	return runtimeFromMinutes(seconds / 60)
+}
+
+// runtimeFromMinutes() converts a number of minutes to a Runtime, checking its range.
+func runtimeFromMinutes(minutes int64) (Runtime, error) {
+	switch {
+	case minutes < 0:
+		return 0, ErrNegativeRuntime
+	case minutes > math.MaxInt32:
+		return 0, ErrRuntimeOverflow
+	}
+
+	return Runtime(minutes), nil
+}
+
+// RuntimeStyle selects how a runtime is written out.
+type RuntimeStyle int
+
+const (
+	RuntimeStyleMins     RuntimeStyle = iota // "102 mins", the default
+	RuntimeStyleMinutes                      // 102 (a number in JSON)
+	RuntimeStyleISO8601                      // "PT1H42M"
+	RuntimeStyleDuration                     // "1h42m"
+)
+
+var runtimeStyleNames = []string{"mins", "minutes", "iso8601", "duration"}
+
+func (s RuntimeStyle) String() string {
+	if s < 0 || int(s) >= len(runtimeStyleNames) {
+		return fmt.Sprintf("RuntimeStyle(%d)", int(s))
+	}
+	return runtimeStyleNames[s]
+}
+
+// ParseRuntimeStyle() converts a style name (see RuntimeStyleNames()) to a
+// RuntimeStyle.
+func ParseRuntimeStyle(s string) (RuntimeStyle, error) {
+	for i, name := range runtimeStyleNames {
+		if strings.EqualFold(s, name) {
+			return RuntimeStyle(i), nil
+		}
+	}
+
+	return 0, fmt.Errorf("unknown runtime style %q", s)
+}
+
+// RuntimeStyleNames() returns the names of the runtime styles.
+func RuntimeStyleNames() []string {
+	return append([]string(nil), runtimeStyleNames...)
+}
+
+// Format() returns the runtime written in the given style. All of them can be read
+// back with ParseRuntime().
+func (r Runtime) Format(style RuntimeStyle) string {
+	hours, minutes := int64(r)/60, int64(r)%60
+
+	switch style {
+	case RuntimeStyleMinutes:
+		return strconv.FormatInt(int64(r), 10)
+
+	case RuntimeStyleISO8601:
+		switch {
+		case hours == 0:
+			return fmt.Sprintf("PT%dM", minutes)
+		case minutes == 0:
+			return fmt.Sprintf("PT%dH", hours)
+		default:
+			return fmt.Sprintf("PT%dH%dM", hours, minutes)
+		}
+
+	case RuntimeStyleDuration:
+		switch {
+		case hours == 0:
+			return fmt.Sprintf("%dm", minutes)
+		case minutes == 0:
+			return fmt.Sprintf("%dh", hours)
+		default:
+			return fmt.Sprintf("%dh%dm", hours, minutes)
+		}
+
+	default:
+		return fmt.Sprintf("%d mins", r)
+	}
+}
+
 // Implement a MarshalJSON() method on the Runtime type so that
 // it satisfies the json.Marshaler() interface. This should return
 // the json encoded value for the movie runtime.
 // (in my case, it will return a string in the format "<runtimes> mins").
 func (r Runtime) MarshalJSON() ([]byte, error) {
-	// Generate a string containing the movie runtime in the required format.
-	jsonValue := fmt.Sprintf("%d mins", r)
-	// Use the strconv.Quote() function to wrap it in double quotes.
-	// It needs to be surrounred by double quotes in order to be a valid *JSON string*.
-	quotedJSONValue := strconv.Quote(jsonValue)
-	// Convert the quoted string value to a byteslice and return it.
-	return []byte(quotedJSONValue), nil
+	return StyledRuntime{Runtime: r}.MarshalJSON()
 }
 
+// UnmarshalJSON() accepts a JSON string in any of the formats ParseRuntime()
+// understands, or a JSON number of minutes. Like the standard library types, a null
+// leaves the runtime unchanged.
 func (r *Runtime) UnmarshalJSON(jsonValue []byte) error {
+	s := string(jsonValue)
+
+	switch {
+	case s == "null":
+		return nil
+
+	case strings.HasPrefix(s, `"`):
+		var text string
+		err := json.Unmarshal(jsonValue, &text)
+		if err != nil {
+			return ErrInvalidRuntimeFormat
+		}
+		return r.UnmarshalText([]byte(text))
+	}
+
+	// Otherwise it should be a number. Whole numbers written with a fraction or an
+	// exponent, like 102.0 or 1.02e2, are fine too.
+	i, err := strconv.ParseInt(s, 10, 64)
+	if errors.Is(err, strconv.ErrRange) {
+		if strings.HasPrefix(s, "-") {
+			return ErrNegativeRuntime
+		}
+		return ErrRuntimeOverflow
+	}
+	if err != nil {
+		f, err := strconv.ParseFloat(s, 64)
+		switch {
+		case err != nil && !errors.Is(err, strconv.ErrRange):
+			return ErrInvalidRuntimeFormat
+		case f < 0:
+			return ErrNegativeRuntime
+		case f > math.MaxInt32:
+			return ErrRuntimeOverflow
+		case f != math.Trunc(f):
+			return ErrRuntimeNotWholeMinutes
+		}
+		i = int64(f)
+	}
+
+	runtime, err := runtimeFromMinutes(i)
+	if err != nil {
+		return err
+	}
+
+	*r = runtime
+	return nil
+}
+
+// MarshalText() and UnmarshalText() implement encoding.TextMarshaler and
+// encoding.TextUnmarshaler, using the default "<n> mins" style for output and
+// ParseRuntime() for input.
+func (r Runtime) MarshalText() ([]byte, error) {
+	return []byte(r.Format(RuntimeStyleMins)), nil
+}
 
-	// We expect that the incoming JSON value will be a string in the format
-	// "<runtime> mins", and the first thing we need to do is remove the
-	// surrounding double-quotes from string. If we cannot unquote, return
-	// ErrInvalidRuntimeFormat error.
-	unquotedJSONValue, err := strconv.Unquote(string(jsonValue))
+func (r *Runtime) UnmarshalText(text []byte) error {
+	runtime, err := ParseRuntime(string(text))
 	if err != nil {
-		return ErrInvalidRuntimeFormat
+		return err
 	}
-	// Split the string to isolate the part containing the number.
-	parts := strings.Split(unquotedJSONValue, " ")
 
-	// Sanity check the the parts of the string to make sure it was in the expected format.
-	// If it isn't, we return the ErrInvalidRuntimeFormat error again.
-	if len(parts) != 2 || parts[1] != "mins" {
-		return ErrInvalidRuntimeFormat
+	*r = runtime
+	return nil
+}
+
+// Value() implements driver.Valuer. The runtime is stored as a number of minutes in
+// an integer column.
+func (r Runtime) Value() (driver.Value, error) {
+	return int64(r), nil
+}
+
+// Scan() implements sql.Scanner, reading the runtime from an integer column (or, in a
+// pinch, a text column in any format ParseRuntime() accepts).
+func (r *Runtime) Scan(src any) error {
+	var (
+		runtime Runtime
+		err     error
+	)
+
+	switch src := src.(type) {
+	case int64:
+		runtime, err = runtimeFromMinutes(src)
+	case []byte:
+		runtime, err = ParseRuntime(string(src))
+	case string:
+		runtime, err = ParseRuntime(src)
+	case nil:
+		return errors.New("cannot scan NULL into a Runtime")
+	default:
+		return fmt.Errorf("cannot scan %T into a Runtime", src)
 	}
-	// Otherwise, parse the string containing the number into an int32. Again,
-	// if this fails, return the ErrInvalidRuntimeFormat.
-	i, err := strconv.ParseInt(parts[0], 10, 32)
+
 	if err != nil {
-		return ErrInvalidRuntimeFormat
+		return err
 	}
-	// Convert the int32 to Runtime type and assign this to the receiver.
-	// Note the usage of * operator to dereference the receiver (which is a pointer
-	// to a Runtime type) in order to set the underlying value of the pointer
-	*r = Runtime(i)
 
+	*r = runtime
 	return nil
 }
+
+// StyledRuntime is a Runtime which is written out in a particular style. In JSON, the
+// RuntimeStyleMinutes style is a number and all the others are strings.
+type StyledRuntime struct {
+	Runtime Runtime
+	Style   RuntimeStyle
+}
+
+func (r StyledRuntime) MarshalJSON() ([]byte, error) {
+	text := r.Runtime.Format(r.Style)
+
+	if r.Style == RuntimeStyleMinutes {
+		return []byte(text), nil
+	}
+
+	// Use the strconv.Quote() function to wrap it in double quotes.
+	// It needs to be surrounred by double quotes in order to be a valid *JSON string*.
+	return []byte(strconv.Quote(text)), nil
+}
+
+func (r StyledRuntime) MarshalText() ([]byte, error) {
+	return []byte(r.Runtime.Format(r.Style)), nil
+}
@@ -0,0 +1,170 @@
+package data
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestParseRuntime(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    Runtime
+		wantErr error
+	}{
+		{input: "102 mins", want: 102},
+		{input: "1 min", want: 1},
+		{input: "102 minutes", want: 102},
+		{input: "102MINS", want: 102},
+		{input: " 102 ", want: 102},
+		{input: "102", want: 102},
+		{input: "0", want: 0},
+		{input: "1h42m", want: 102},
+		{input: "90m", want: 90},
+		{input: "2h", want: 120},
+		{input: "6120s", want: 102},
+		{input: "PT1H42M", want: 102},
+		{input: "pt102m", want: 102},
+		{input: "PT6120S", want: 102},
+		{input: "P1DT2H", want: 1560},
+		{input: "P1D", want: 1440},
+		{input: "2147483647", want: 2147483647},
+		{input: "", wantErr: ErrInvalidRuntimeFormat},
+		{input: "mins", wantErr: ErrInvalidRuntimeFormat},
+		{input: "102 hours", wantErr: ErrInvalidRuntimeFormat},
+		{input: "1.5h", wantErr: ErrInvalidRuntimeFormat},
+		{input: "1H42M", wantErr: ErrInvalidRuntimeFormat},
+		{input: "P", wantErr: ErrInvalidRuntimeFormat},
+		{input: "PT", wantErr: ErrInvalidRuntimeFormat},
+		{input: "P1Y", wantErr: ErrInvalidRuntimeFormat},
+		{input: "-foo", wantErr: ErrInvalidRuntimeFormat},
+		{input: "-1", wantErr: ErrNegativeRuntime},
+		{input: "-PT1H", wantErr: ErrNegativeRuntime},
+		{input: "2147483648", wantErr: ErrRuntimeOverflow},
+		{input: "99999999999999999999 mins", wantErr: ErrRuntimeOverflow},
+		{input: "P9999999999999999D", wantErr: ErrRuntimeOverflow},
+		{input: "90s", wantErr: ErrRuntimeNotWholeMinutes},
+		{input: "PT1M30S", wantErr: ErrRuntimeNotWholeMinutes},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseRuntime(tt.input)
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v; want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("got %d; want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRuntimeUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    Runtime
+		wantErr error
+	}{
+		{input: `"102 mins"`, want: 102},
+		{input: `"PT1H42M"`, want: 102},
+		{input: `102`, want: 102},
+		{input: `102.0`, want: 102},
+		{input: `1.02e2`, want: 102},
+		{input: `null`, want: 7},
+		{input: `-1`, wantErr: ErrNegativeRuntime},
+		{input: `-1e400`, wantErr: ErrNegativeRuntime},
+		{input: `2147483648`, wantErr: ErrRuntimeOverflow},
+		{input: `99999999999999999999`, wantErr: ErrRuntimeOverflow},
+		{input: `1e400`, wantErr: ErrRuntimeOverflow},
+		{input: `102.5`, wantErr: ErrRuntimeNotWholeMinutes},
+		{input: `"102 secs"`, wantErr: ErrInvalidRuntimeFormat},
+		{input: `true`, wantErr: ErrInvalidRuntimeFormat},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			// Start with a runtime already set, to check that null leaves it alone.
+			var movie struct{ Runtime Runtime }
+			movie.Runtime = 7
+
+			err := json.Unmarshal([]byte(`{"Runtime": `+tt.input+`}`), &movie)
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v; want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && movie.Runtime != tt.want {
+				t.Errorf("got %d; want %d", movie.Runtime, tt.want)
+			}
+		})
+	}
+}
+
+// Every style must be readable by ParseRuntime(), so that a client can send back what
+// it was given.
+func TestRuntimeFormat(t *testing.T) {
+	tests := []struct {
+		runtime Runtime
+		want    map[RuntimeStyle]string
+	}{
+		{runtime: 102, want: map[RuntimeStyle]string{
+			RuntimeStyleMins: "102 mins", RuntimeStyleMinutes: "102", RuntimeStyleISO8601: "PT1H42M", RuntimeStyleDuration: "1h42m",
+		}},
+		{runtime: 120, want: map[RuntimeStyle]string{
+			RuntimeStyleMins: "120 mins", RuntimeStyleMinutes: "120", RuntimeStyleISO8601: "PT2H", RuntimeStyleDuration: "2h",
+		}},
+		{runtime: 42, want: map[RuntimeStyle]string{
+			RuntimeStyleMins: "42 mins", RuntimeStyleMinutes: "42", RuntimeStyleISO8601: "PT42M", RuntimeStyleDuration: "42m",
+		}},
+		{runtime: 0, want: map[RuntimeStyle]string{
+			RuntimeStyleMins: "0 mins", RuntimeStyleMinutes: "0", RuntimeStyleISO8601: "PT0M", RuntimeStyleDuration: "0m",
+		}},
+	}
+
+	for _, tt := range tests {
+		for style, want := range tt.want {
+			got := tt.runtime.Format(style)
+			if got != want {
+				t.Errorf("%d in style %s: got %q; want %q", tt.runtime, style, got, want)
+			}
+
+			parsed, err := ParseRuntime(got)
+			if err != nil || parsed != tt.runtime {
+				t.Errorf("ParseRuntime(%q) = %d, %v; want %d", got, parsed, err, tt.runtime)
+			}
+		}
+	}
+}
+
+func TestRuntimeScan(t *testing.T) {
+	tests := []struct {
+		src     any
+		want    Runtime
+		wantErr bool
+	}{
+		{src: int64(102), want: 102},
+		{src: []byte("102 mins"), want: 102},
+		{src: "PT1H42M", want: 102},
+		{src: int64(-1), wantErr: true},
+		{src: nil, wantErr: true},
+		{src: 1.5, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		var r Runtime
+
+		err := r.Scan(tt.src)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Scan(%#v): got error %v; want error %t", tt.src, err, tt.wantErr)
+		}
+		if r != tt.want {
+			t.Errorf("Scan(%#v): got %d; want %d", tt.src, r, tt.want)
+		}
+	}
+
+	value, err := Runtime(102).Value()
+	if err != nil || value != int64(102) {
+		t.Errorf("Value() = %#v, %v; want int64(102)", value, err)
+	}
+}
@@ -0,0 +1,122 @@
+package data
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base32"
+	"time"
+
+	"delsanchez.gl/internal/validator"
+)
+
+// Define constants for the token scope. A token is only ever valid for the one purpose
+// it was created for.
+const (
+	ScopeActivation     = "activation"
+	ScopeAuthentication = "authentication"
+	ScopePasswordReset  = "password-reset"
+)
+
+// A Token struct to hold the data for an individual token. This includes the plaintext
+// and hashed versions of the token, associated user ID, expiry time and scope. Only
+// the plaintext token and expiry time are ever included in a JSON response.
+type Token struct {
+	Plaintext string    `json:"token"`
+	Hash      []byte    `json:"-"`
+	UserID    int64     `json:"-"`
+	Expiry    time.Time `json:"expiry"`
+	Scope     string    `json:"-"`
+}
+
+func generateToken(userID int64, ttl time.Duration, scope string) (*Token, error) {
+	// Create a Token instance containing the user ID, expiry, and scope information.
+	// Notice that we add the provided ttl (time-to-live) duration parameter to the
+	// current time to get the expiry time.
+	token := &Token{
+		UserID: userID,
+		Expiry: time.Now().Add(ttl),
+		Scope:  scope,
+	}
+
+	// Initialize a zero-valued byte slice with a length of 16 bytes, and fill it with
+	// random bytes from the operating system's CSPRNG.
+	randomBytes := make([]byte, 16)
+
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	// Encode the byte slice to a base-32-encoded string and assign it to the token
+	// Plaintext field. This will be the token string that we send to the user. Note
+	// that by default base-32 strings may be padded at the end with the = character.
+	// We don't need this padding character, so we omit it. The result is always a
+	// 26 character string.
+	token.Plaintext = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes)
+
+	// Generate a SHA-256 hash of the plaintext token string. This will be the value
+	// that we store in the `hash` field of our database table.
+	hash := sha256.Sum256([]byte(token.Plaintext))
+	token.Hash = hash[:]
+
+	return token, nil
+}
+
+// Check that the plaintext token has been provided and is exactly 26 bytes long.
+func ValidateTokenPlaintext(v *validator.Validator, tokenPlaintext string) {
+	v.Check(tokenPlaintext != "", "token", "must be provided")
+	v.Check(len(tokenPlaintext) == 26, "token", "must be 26 bytes long")
+}
+
+// A TokenModel struct type which wraps a sql.DB connection pool, and the time limit for
+// each query.
+type TokenModel struct {
+	DB      *sql.DB
+	Timeout time.Duration
+}
+
+// The New() method is a shortcut which creates a new Token struct and then inserts the
+// data in the tokens table.
+func (m TokenModel) New(ctx context.Context, userID int64, ttl time.Duration, scope string) (*Token, error) {
+	token, err := generateToken(userID, ttl, scope)
+	if err != nil {
+		return nil, err
+	}
+
+	err = m.Insert(ctx, token)
+	return token, err
+}
+
+// Insert() adds the data for a specific token to the tokens table.
+func (m TokenModel) Insert(ctx context.Context, token *Token) error {
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	return insertToken(ctx, m.DB, token)
+}
+
+func insertToken(ctx context.Context, q querier, token *Token) error {
+	query := `
+		INSERT INTO tokens (hash, user_id, expiry, scope)
+		VALUES ($1, $2, $3, $4)`
+
+	args := []any{token.Hash, token.UserID, token.Expiry, token.Scope}
+
+	_, err := q.ExecContext(ctx, query, args...)
+	return contextError(ctx, err)
+}
+
+// DeleteAllForUser() deletes all tokens for a specific user and scope.
+func (m TokenModel) DeleteAllForUser(ctx context.Context, scope string, userID int64) error {
+	query := `
+		DELETE FROM tokens
+		WHERE scope = $1 AND user_id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, scope, userID)
+	return contextError(ctx, err)
+}
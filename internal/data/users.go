@@ -0,0 +1,336 @@
+package data
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"time"
+
+	"delsanchez.gl/internal/validator"
+	"github.com/lib/pq"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Define a custom ErrDuplicateEmail error, returned when a user tries to register
+// with an email address which is already in use.
+var (
+	ErrDuplicateEmail = errors.New("duplicate email")
+)
+
+// Declare a new AnonymousUser variable, which represents a request that didn't come
+// with an authentication token.
+var AnonymousUser = &User{}
+
+// A User struct to represent an individual user. The json:"-" struct tags prevent the
+// Password and Version fields from ever appearing in a response.
+type User struct {
+	ID        int64     `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	Name      string    `json:"name"`
+	Email     string    `json:"email"`
+	Password  password  `json:"-"`
+	Activated bool      `json:"activated"`
+	Version   int       `json:"-"`
+}
+
+// Check if a User instance is the AnonymousUser.
+func (u *User) IsAnonymous() bool {
+	return u == AnonymousUser
+}
+
+// A custom password type which holds the plaintext and hashed versions of the password
+// for a user. The plaintext field is a *pointer* to a string, so that we're able to
+// distinguish between a plaintext password not being present in the struct at all,
+// versus a plaintext password which is the empty string "".
+type password struct {
+	plaintext *string
+	hash      []byte
+}
+
+// The Set() method calculates the bcrypt hash of a plaintext password, and stores both
+// the hash and the plaintext versions in the struct. bcrypt refuses to hash passwords
+// longer than 72 bytes, so for those we only store the plaintext and leave it to
+// ValidatePasswordPlaintext() to reject them with a proper validation error.
+func (p *password) Set(plaintextPassword string) error {
+	p.plaintext = &plaintextPassword
+	p.hash = nil
+
+	if len(plaintextPassword) > 72 {
+		return nil
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(plaintextPassword), 12)
+	if err != nil {
+		return err
+	}
+
+	p.hash = hash
+
+	return nil
+}
+
+// The Matches() method checks whether the provided plaintext password matches the
+// hashed password stored in the struct, returning true if it matches and false
+// otherwise.
+func (p *password) Matches(plaintextPassword string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword(p.hash, []byte(plaintextPassword))
+	if err != nil {
+		switch {
+		case errors.Is(err, bcrypt.ErrMismatchedHashAndPassword):
+			return false, nil
+		default:
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+func ValidateEmail(v *validator.Validator, email string) {
+	v.Check(email != "", "email", "must be provided")
+	v.Check(validator.Matches(email, validator.EmailRX), "email", "must be a valid email address")
+}
+
+// bcrypt only looks at the first 72 bytes of the password, so we don't accept
+// anything longer than that.
+func ValidatePasswordPlaintext(v *validator.Validator, password string) {
+	v.Check(password != "", "password", "must be provided")
+	v.Check(len(password) >= 8, "password", "must be at least 8 bytes long")
+	v.Check(len(password) <= 72, "password", "must not be more than 72 bytes long")
+}
+
+func ValidateUser(v *validator.Validator, user *User) {
+	v.Check(user.Name != "", "name", "must be provided")
+	v.Check(len(user.Name) <= 500, "name", "must not be more than 500 bytes long")
+
+	ValidateEmail(v, user.Email)
+
+	// If the plaintext password is not nil, call the standalone
+	// ValidatePasswordPlaintext() helper.
+	if user.Password.plaintext != nil {
+		ValidatePasswordPlaintext(v, *user.Password.plaintext)
+	}
+
+	// If the password hash is ever nil, this will be due to a logic error in our
+	// codebase (probably because we forgot to set a password for the user). It's a
+	// useful sanity check to include here, but it's not a problem with the data
+	// provided by the client. So rather than adding an error to the validation map we
+	// raise a panic instead. (The one exception is a password which was too long to
+	// hash, which has already been recorded as a validation error above.)
+	if _, invalidPassword := v.Errors["password"]; user.Password.hash == nil && !invalidPassword {
+		panic("missing password hash for user")
+	}
+}
+
+// isDuplicateEmail() reports whether err is PostgreSQL complaining about a violation of
+// the UNIQUE constraint on the users.email column.
+func isDuplicateEmail(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505" && pqErr.Constraint == "users_email_key"
+}
+
+// A UserModel struct type which wraps a sql.DB connection pool, and the time limit for
+// each query.
+type UserModel struct {
+	DB      *sql.DB
+	Timeout time.Duration
+}
+
+// Insert a new record in the database for the user. Note that the id, created_at and
+// version fields are all automatically generated by our database, so we use the
+// RETURNING clause to read them into the User struct after the insert. The email
+// column has the case-insensitive citext type and a UNIQUE constraint, so if a user
+// with the same email (in any letter case) already exists, we return an
+// ErrDuplicateEmail error.
+func (m UserModel) Insert(ctx context.Context, user *User) error {
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	return insertUser(ctx, m.DB, user)
+}
+
+func insertUser(ctx context.Context, q querier, user *User) error {
+	query := `
+		INSERT INTO users (name, email, password_hash, activated)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at, version`
+
+	args := []any{user.Name, user.Email, user.Password.hash, user.Activated}
+
+	err := q.QueryRowContext(ctx, query, args...).Scan(&user.ID, &user.CreatedAt, &user.Version)
+	if err != nil {
+		switch {
+		case isDuplicateEmail(err):
+			return ErrDuplicateEmail
+		default:
+			return contextError(ctx, err)
+		}
+	}
+
+	return nil
+}
+
+// Register() inserts a new user, grants them the given permissions and creates an
+// activation token for them, which it returns. It all happens in one transaction (and
+// the timeout applies to the transaction as a whole), so if any step fails, or the
+// client goes away, no trace of the user is left behind and they can simply register
+// again with the same email address.
+func (m UserModel) Register(ctx context.Context, user *User, activationTTL time.Duration, permissions ...string) (*Token, error) {
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, contextError(ctx, err)
+	}
+	// Rollback() is a no-op once the transaction has been committed.
+	defer tx.Rollback()
+
+	err = insertUser(ctx, tx, user)
+	if err != nil {
+		return nil, err
+	}
+
+	err = addPermissionsForUser(ctx, tx, user.ID, permissions...)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := generateToken(user.ID, activationTTL, ScopeActivation)
+	if err != nil {
+		return nil, err
+	}
+
+	err = insertToken(ctx, tx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, contextError(ctx, err)
+	}
+
+	return token, nil
+}
+
+// Retrieve the User details from the database based on the user's email address.
+// Because we have a UNIQUE constraint on the email column, this SQL query will only
+// return one record (or none at all, in which case we return a ErrRecordNotFound error).
+func (m UserModel) GetByEmail(ctx context.Context, email string) (*User, error) {
+	query := `
+		SELECT id, created_at, name, email, password_hash, activated, version
+		FROM users
+		WHERE email = $1`
+
+	var user User
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, email).Scan(
+		&user.ID,
+		&user.CreatedAt,
+		&user.Name,
+		&user.Email,
+		&user.Password.hash,
+		&user.Activated,
+		&user.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, contextError(ctx, err)
+		}
+	}
+
+	return &user, nil
+}
+
+// Update the details for a specific user. Notice that we check against the version
+// field to help prevent any race conditions during the request cycle, just like we do
+// when updating a movie. And we also check for a violation of the "users_email_key"
+// constraint when performing the update.
+func (m UserModel) Update(ctx context.Context, user *User) error {
+	query := `
+		UPDATE users
+		SET name = $1, email = $2, password_hash = $3, activated = $4, version = version + 1
+		WHERE id = $5 AND version = $6
+		RETURNING version`
+
+	args := []any{
+		user.Name,
+		user.Email,
+		user.Password.hash,
+		user.Activated,
+		user.ID,
+		user.Version,
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&user.Version)
+	if err != nil {
+		switch {
+		case isDuplicateEmail(err):
+			return ErrDuplicateEmail
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return contextError(ctx, err)
+		}
+	}
+
+	return nil
+}
+
+// GetForToken() retrieves the user associated with a plaintext token of the given
+// scope. Only the SHA-256 hash of the token is stored, so we hash the plaintext
+// before looking it up, and expired tokens are ignored.
+func (m UserModel) GetForToken(ctx context.Context, tokenScope, tokenPlaintext string) (*User, error) {
+	// Calculate the SHA-256 hash of the plaintext token provided by the client.
+	// Remember that this returns a byte *array* with length 32, not a slice.
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+
+	query := `
+		SELECT users.id, users.created_at, users.name, users.email, users.password_hash, users.activated, users.version
+		FROM users
+		INNER JOIN tokens
+		ON users.id = tokens.user_id
+		WHERE tokens.hash = $1
+		AND tokens.scope = $2
+		AND tokens.expiry > $3`
+
+	// Notice that we use the [:] operator to get a slice containing the token hash,
+	// rather than passing in the array (which is not supported by the pq driver).
+	args := []any{tokenHash[:], tokenScope, time.Now()}
+
+	var user User
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(
+		&user.ID,
+		&user.CreatedAt,
+		&user.Name,
+		&user.Email,
+		&user.Password.hash,
+		&user.Activated,
+		&user.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, contextError(ctx, err)
+		}
+	}
+
+	return &user, nil
+}
@@ -0,0 +1,199 @@
+package jsonlog
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Define a Level type to represent the severity level for a log entry.
+type Level int8
+
+// Initialize constants which represent a specific severity level. We use the iota
+// keyword as a shortcut to assign successive integer values to the constants.
+const (
+	LevelDebug Level = iota // Has the value 0.
+	LevelInfo               // Has the value 1.
+	LevelWarn               // Has the value 2.
+	LevelError              // Has the value 3.
+	LevelFatal              // Has the value 4.
+	LevelOff                // Has the value 5.
+)
+
+// Return a human-friendly string for the severity level.
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "DEBUG"
+	case LevelInfo:
+		return "INFO"
+	case LevelWarn:
+		return "WARN"
+	case LevelError:
+		return "ERROR"
+	case LevelFatal:
+		return "FATAL"
+	case LevelOff:
+		return "OFF"
+	default:
+		return ""
+	}
+}
+
+// ParseLevel() converts a level name such as "info" (case-insensitive) to a Level.
+func ParseLevel(s string) (Level, error) {
+	for l := LevelDebug; l <= LevelOff; l++ {
+		if strings.EqualFold(s, l.String()) {
+			return l, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid log level %q (must be one of debug|info|warn|error|fatal|off)", s)
+}
+
+// A Format controls how each log entry is written out.
+type Format int8
+
+const (
+	FormatJSON Format = iota // One JSON object per line.
+	FormatText               // A human-friendly "time LEVEL message key=value" line.
+)
+
+// ParseFormat() converts "json" or "text" (case-insensitive) to a Format.
+func ParseFormat(s string) (Format, error) {
+	switch strings.ToLower(s) {
+	case "json":
+		return FormatJSON, nil
+	case "text":
+		return FormatText, nil
+	default:
+		return 0, fmt.Errorf("invalid log format %q (must be one of text|json)", s)
+	}
+}
+
+// Define a custom Logger type. This holds the output destination that the log entries
+// will be written to, the minimum severity level that log entries will be written for,
+// the output format, plus a mutex for coordinating the writes.
+type Logger struct {
+	out      io.Writer
+	minLevel Level
+	format   Format
+	mu       sync.Mutex
+}
+
+// Return a new Logger instance which writes log entries at or above a minimum severity
+// level to a specific output destination.
+func New(out io.Writer, minLevel Level, format Format) *Logger {
+	return &Logger{
+		out:      out,
+		minLevel: minLevel,
+		format:   format,
+	}
+}
+
+// Declare some helper methods for writing log entries at the different levels. Notice
+// that these all accept a map as the second parameter which can contain any arbitrary
+// 'properties' that you want to appear in the log entry.
+func (l *Logger) PrintDebug(message string, properties map[string]string) {
+	l.print(LevelDebug, message, properties)
+}
+
+func (l *Logger) PrintInfo(message string, properties map[string]string) {
+	l.print(LevelInfo, message, properties)
+}
+
+func (l *Logger) PrintWarn(message string, properties map[string]string) {
+	l.print(LevelWarn, message, properties)
+}
+
+func (l *Logger) PrintError(err error, properties map[string]string) {
+	l.print(LevelError, err.Error(), properties)
+}
+
+// For entries at the FATAL level, we also terminate the application.
+func (l *Logger) PrintFatal(err error, properties map[string]string) {
+	l.print(LevelFatal, err.Error(), properties)
+	os.Exit(1)
+}
+
+// Print is an internal method for writing the log entry.
+func (l *Logger) print(level Level, message string, properties map[string]string) (int, error) {
+	// If the severity level of the log entry is below the minimum severity for the
+	// logger, then return with no further action.
+	if level < l.minLevel {
+		return 0, nil
+	}
+
+	// Declare an anonymous struct holding the data for the log entry.
+	aux := struct {
+		Level      string            `json:"level"`
+		Time       string            `json:"time"`
+		Message    string            `json:"message"`
+		Properties map[string]string `json:"properties,omitempty"`
+		Trace      string            `json:"trace,omitempty"`
+	}{
+		Level:      level.String(),
+		Time:       time.Now().UTC().Format(time.RFC3339),
+		Message:    message,
+		Properties: properties,
+	}
+
+	// Include a stack trace for entries at the ERROR and FATAL levels.
+	if level >= LevelError {
+		aux.Trace = string(debug.Stack())
+	}
+
+	var line []byte
+
+	switch l.format {
+	case FormatText:
+		var b strings.Builder
+		fmt.Fprintf(&b, "%s %-5s %s", aux.Time, aux.Level, aux.Message)
+
+		// Sort the property keys so that entries are written in a predictable order.
+		keys := make([]string, 0, len(properties))
+		for key := range properties {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			fmt.Fprintf(&b, " %s=%q", key, properties[key])
+		}
+		if aux.Trace != "" {
+			b.WriteString("\n" + aux.Trace)
+		}
+		line = []byte(b.String())
+	default:
+		// Marshal the anonymous struct to JSON and store it in the line variable. If
+		// there was a problem creating the JSON, set the contents of the log entry to
+		// be that plain-text error message instead.
+		var err error
+		line, err = json.Marshal(aux)
+		if err != nil {
+			line = []byte(LevelError.String() + ": unable to marshal log message: " + err.Error())
+		}
+	}
+
+	// Lock the mutex so that no two writes to the output destination can happen
+	// concurrently. If we don't do this, it's possible that the text for two or more
+	// log entries will be intermingled in the output.
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// Write the log entry followed by a newline.
+	return l.out.Write(append(line, '\n'))
+}
+
+// We also implement a Write() method on our Logger type so that it satisfies the
+// io.Writer interface. This writes a log entry at the ERROR level with no additional
+// properties, and lets us use the Logger as the destination for a standard library
+// *log.Logger (such as the http.Server ErrorLog).
+func (l *Logger) Write(message []byte) (n int, err error) {
+	return l.print(LevelError, strings.TrimSuffix(string(message), "\n"), nil)
+}
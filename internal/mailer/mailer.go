@@ -0,0 +1,282 @@
+package mailer
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	htmltemplate "html/template"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"strconv"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// Below we declare a new variable with the type embed.FS (embedded file system) to hold
+// our email templates. This has a comment directive in the format `//go:embed <path>`
+// IMMEDIATELY ABOVE it, which indicates to Go that we want to store the contents of the
+// ./templates directory in the templateFS embedded file system variable.
+//
+//go:embed "templates"
+var templateFS embed.FS
+
+// A Mailer sends an email built from one of the embedded templates. The dynamic data
+// for the template is passed in data.
+type Mailer interface {
+	Send(recipient, templateFile string, data any) error
+}
+
+// A Message is a rendered email, ready to be sent.
+type Message struct {
+	Recipient string
+	Subject   string
+	PlainBody string
+	HTMLBody  string
+}
+
+// render() executes the "subject", "plainBody" and "htmlBody" templates defined in
+// templateFile. The HTML body is rendered with html/template so that the dynamic
+// data is escaped properly.
+func render(recipient, templateFile string, data any) (Message, error) {
+	tmpl, err := template.New("email").ParseFS(templateFS, "templates/"+templateFile)
+	if err != nil {
+		return Message{}, err
+	}
+
+	subject := new(bytes.Buffer)
+	err = tmpl.ExecuteTemplate(subject, "subject", data)
+	if err != nil {
+		return Message{}, err
+	}
+
+	plainBody := new(bytes.Buffer)
+	err = tmpl.ExecuteTemplate(plainBody, "plainBody", data)
+	if err != nil {
+		return Message{}, err
+	}
+
+	htmlTmpl, err := htmltemplate.New("email").ParseFS(templateFS, "templates/"+templateFile)
+	if err != nil {
+		return Message{}, err
+	}
+
+	htmlBody := new(bytes.Buffer)
+	err = htmlTmpl.ExecuteTemplate(htmlBody, "htmlBody", data)
+	if err != nil {
+		return Message{}, err
+	}
+
+	return Message{
+		Recipient: recipient,
+		Subject:   subject.String(),
+		PlainBody: plainBody.String(),
+		HTMLBody:  htmlBody.String(),
+	}, nil
+}
+
+// SMTPMailer sends emails through an SMTP server, using STARTTLS and PLAIN auth when
+// the server supports them. The server's certificate is verified against the system
+// roots, unless rootCAs is set (which the tests do).
+type SMTPMailer struct {
+	addr     string
+	host     string
+	auth     smtp.Auth
+	sender   string
+	timeout  time.Duration
+	attempts int
+	rootCAs  *x509.CertPool
+}
+
+// NewSMTP() returns a SMTPMailer for the given server and credentials. The sender is
+// the "From" address, e.g. "Greenlight <no-reply@greenlight.example.com>".
+func NewSMTP(host string, port int, username, password, sender string) *SMTPMailer {
+	m := &SMTPMailer{
+		addr:     net.JoinHostPort(host, strconv.Itoa(port)),
+		host:     host,
+		sender:   sender,
+		timeout:  5 * time.Second,
+		attempts: 3,
+	}
+	if username != "" {
+		m.auth = smtp.PlainAuth("", username, password, host)
+	}
+	return m
+}
+
+// Send() renders the template and delivers the message, retrying a couple of times
+// (with a short pause) if delivery fails, since SMTP servers are often flaky.
+func (m *SMTPMailer) Send(recipient, templateFile string, data any) error {
+	msg, err := render(recipient, templateFile, data)
+	if err != nil {
+		return err
+	}
+
+	body, err := m.encode(msg)
+	if err != nil {
+		return err
+	}
+
+	for i := 1; i <= m.attempts; i++ {
+		err = m.deliver(recipient, body)
+		if err == nil {
+			return nil
+		}
+
+		if i < m.attempts {
+			time.Sleep(500 * time.Millisecond)
+		}
+	}
+
+	return err
+}
+
+func (m *SMTPMailer) deliver(recipient string, body []byte) error {
+	// net/smtp doesn't have timeouts of its own, so dial the connection ourselves and
+	// put a deadline on the whole exchange.
+	conn, err := net.DialTimeout("tcp", m.addr, m.timeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	err = conn.SetDeadline(time.Now().Add(m.timeout))
+	if err != nil {
+		return err
+	}
+
+	c, err := smtp.NewClient(conn, m.host)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		// crypto/tls needs to know the server name to verify the certificate against.
+		err = c.StartTLS(&tls.Config{ServerName: m.host, RootCAs: m.rootCAs})
+		if err != nil {
+			return err
+		}
+	}
+
+	if m.auth != nil {
+		err = c.Auth(m.auth)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = c.Mail(m.sender)
+	if err != nil {
+		return err
+	}
+
+	err = c.Rcpt(recipient)
+	if err != nil {
+		return err
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(body)
+	if err != nil {
+		return err
+	}
+
+	err = w.Close()
+	if err != nil {
+		return err
+	}
+
+	return c.Quit()
+}
+
+// encode() builds a multipart/alternative MIME message containing both the plain text
+// and the HTML bodies.
+func (m *SMTPMailer) encode(msg Message) ([]byte, error) {
+	randomBytes := make([]byte, 12)
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return nil, err
+	}
+	boundary := hex.EncodeToString(randomBytes)
+
+	var buf bytes.Buffer
+
+	fmt.Fprintf(&buf, "From: %s\r\n", m.sender)
+	fmt.Fprintf(&buf, "To: %s\r\n", msg.Recipient)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", msg.Subject)
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&buf, "Content-Type: multipart/alternative; boundary=%q\r\n\r\n", boundary)
+
+	parts := []struct {
+		contentType string
+		body        string
+	}{
+		{"text/plain", msg.PlainBody},
+		{"text/html", msg.HTMLBody},
+	}
+
+	for _, part := range parts {
+		fmt.Fprintf(&buf, "--%s\r\n", boundary)
+		fmt.Fprintf(&buf, "Content-Type: %s; charset=UTF-8\r\n", part.contentType)
+		fmt.Fprintf(&buf, "Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+
+		qp := quotedprintable.NewWriter(&buf)
+		_, err = qp.Write([]byte(part.body))
+		if err != nil {
+			return nil, err
+		}
+		err = qp.Close()
+		if err != nil {
+			return nil, err
+		}
+		buf.WriteString("\r\n")
+	}
+
+	fmt.Fprintf(&buf, "--%s--\r\n", boundary)
+
+	return buf.Bytes(), nil
+}
+
+// MemoryMailer is a stand-in Mailer which renders the messages but keeps them in
+// memory instead of sending them. It's used in development (when no SMTP server is
+// configured) and in tests.
+type MemoryMailer struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+func NewMemory() *MemoryMailer {
+	return &MemoryMailer{}
+}
+
+func (m *MemoryMailer) Send(recipient, templateFile string, data any) error {
+	msg, err := render(recipient, templateFile, data)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.messages = append(m.messages, msg)
+	return nil
+}
+
+// Messages() returns a copy of all the messages sent so far, oldest first.
+func (m *MemoryMailer) Messages() []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]Message(nil), m.messages...)
+}
@@ -0,0 +1,175 @@
+package mailer
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"net"
+	"net/http/httptest"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeSMTPServer is just enough of an SMTP server to accept one message over STARTTLS
+// with PLAIN auth. It records what the client did.
+type fakeSMTPServer struct {
+	listener net.Listener
+	tls      *tls.Config
+	done     chan struct{}
+
+	// These are only safe to read once done is closed.
+	usedTLS bool
+	auth    string
+	from    string
+	to      string
+	data    string
+	err     error
+}
+
+func newFakeSMTPServer(t *testing.T) (*fakeSMTPServer, *x509.CertPool) {
+	t.Helper()
+
+	// Borrow the self-signed certificate (valid for 127.0.0.1) that httptest uses.
+	ts := httptest.NewUnstartedServer(nil)
+	ts.StartTLS()
+	certificates := ts.TLS.Certificates
+	roots := x509.NewCertPool()
+	roots.AddCert(ts.Certificate())
+	ts.Close()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	s := &fakeSMTPServer{
+		listener: listener,
+		tls:      &tls.Config{Certificates: certificates},
+		done:     make(chan struct{}),
+	}
+	go s.serve()
+
+	return s, roots
+}
+
+func (s *fakeSMTPServer) serve() {
+	defer close(s.done)
+
+	conn, err := s.listener.Accept()
+	if err != nil {
+		s.err = err
+		return
+	}
+	defer func() { conn.Close() }()
+
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	text := textproto.NewConn(conn)
+	text.PrintfLine("220 localhost ESMTP")
+
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			s.err = err
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+
+		switch strings.ToUpper(verb) {
+		case "EHLO":
+			if s.usedTLS {
+				text.PrintfLine("250-localhost\r\n250 AUTH PLAIN")
+			} else {
+				text.PrintfLine("250-localhost\r\n250 STARTTLS")
+			}
+		case "STARTTLS":
+			text.PrintfLine("220 ready to start TLS")
+			tlsConn := tls.Server(conn, s.tls)
+			err = tlsConn.Handshake()
+			if err != nil {
+				s.err = err
+				return
+			}
+			conn, s.usedTLS = tlsConn, true
+			text = textproto.NewConn(conn)
+		case "AUTH":
+			s.auth = arg
+			text.PrintfLine("235 authenticated")
+		case "MAIL":
+			s.from = arg
+			text.PrintfLine("250 ok")
+		case "RCPT":
+			s.to = arg
+			text.PrintfLine("250 ok")
+		case "DATA":
+			text.PrintfLine("354 go ahead")
+			data, err := text.ReadDotBytes()
+			if err != nil {
+				s.err = err
+				return
+			}
+			s.data = string(data)
+			text.PrintfLine("250 queued")
+		case "QUIT":
+			text.PrintfLine("221 bye")
+			return
+		default:
+			text.PrintfLine("502 unknown command")
+		}
+	}
+}
+
+func TestSMTPMailerSend(t *testing.T) {
+	server, roots := newFakeSMTPServer(t)
+
+	host, portString, _ := net.SplitHostPort(server.listener.Addr().String())
+	port, _ := strconv.Atoi(portString)
+
+	m := NewSMTP(host, port, "alice", "pa55word", "Greenlight <no-reply@greenlight.example.com>")
+	m.rootCAs = roots
+	m.attempts = 1
+
+	err := m.Send("bob@example.com", "user_welcome.tmpl", map[string]any{
+		"activationToken": "Y3QMGX3PJ3WLRL2YRTQGQ6KRHU",
+		"userID":          7,
+	})
+	if err != nil {
+		t.Fatalf("Send() = %v", err)
+	}
+
+	<-server.done
+	if server.err != nil {
+		t.Fatalf("fake server: %v", server.err)
+	}
+
+	if !server.usedTLS {
+		t.Error("the message wasn't sent over TLS")
+	}
+
+	wantAuth := "PLAIN " + base64.StdEncoding.EncodeToString([]byte("\x00alice\x00pa55word"))
+	if server.auth != wantAuth {
+		t.Errorf("got AUTH %q; want %q", server.auth, wantAuth)
+	}
+	if !strings.Contains(server.from, "no-reply@greenlight.example.com") {
+		t.Errorf("got MAIL %q; want no-reply@greenlight.example.com", server.from)
+	}
+	if !strings.Contains(server.to, "bob@example.com") {
+		t.Errorf("got RCPT %q; want bob@example.com", server.to)
+	}
+
+	msg, err := textproto.NewReader(bufio.NewReader(strings.NewReader(server.data))).ReadMIMEHeader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := msg.Get("Subject"); got != "Welcome to Greenlight!" {
+		t.Errorf("got Subject %q", got)
+	}
+	if !strings.Contains(server.data, "Y3QMGX3PJ3WLRL2YRTQGQ6KRHU") {
+		t.Error("the message doesn't contain the activation token")
+	}
+}
@@ -0,0 +1,310 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// An arbitrary key for the PostgreSQL advisory lock which is held while migrations
+// run. This stops two instances of the application (for example, two pods started
+// with -db-auto-migrate) from applying the same migration at the same time.
+const lockKey = 7_311_426_001
+
+var (
+	ErrNoChange       = errors.New("no change")
+	ErrUnknownVersion = errors.New("unknown migration version")
+)
+
+// Migration filenames must be in the format "<version>_<name>.<up|down>.sql".
+var filenameRX = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// A Migration holds the up and down SQL for a single schema version.
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// A Status reports whether a specific migration has been applied, and when.
+type Status struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// A Migrator applies the migrations found in a fs.FS to a database, keeping track
+// of the applied versions in the schema_migrations table.
+type Migrator struct {
+	DB         *sql.DB
+	migrations []Migration
+}
+
+// New() reads and sanity checks all the migration files in fsys. Every version must
+// have both an up and a down file.
+func New(db *sql.DB, fsys fs.FS) (*Migrator, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int64]*Migration)
+
+	for _, entry := range entries {
+		if entry.IsDir() || path.Ext(entry.Name()) != ".sql" {
+			continue
+		}
+
+		matches := filenameRX.FindStringSubmatch(entry.Name())
+		if matches == nil {
+			return nil, fmt.Errorf("invalid migration filename %q", entry.Name())
+		}
+
+		version, err := strconv.ParseInt(matches[1], 10, 64)
+		if err != nil || version < 1 {
+			return nil, fmt.Errorf("invalid migration version in %q", entry.Name())
+		}
+
+		content, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		m, exists := byVersion[version]
+		if !exists {
+			m = &Migration{Version: version, Name: matches[2]}
+			byVersion[version] = m
+		}
+		if m.Name != matches[2] {
+			return nil, fmt.Errorf("migration %d has conflicting names %q and %q", version, m.Name, matches[2])
+		}
+
+		switch matches[3] {
+		case "up":
+			m.Up = string(content)
+		case "down":
+			m.Down = string(content)
+		}
+	}
+
+	migrator := &Migrator{DB: db}
+
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s must have both an up and a down file", m.Version, m.Name)
+		}
+		migrator.migrations = append(migrator.migrations, *m)
+	}
+
+	sort.Slice(migrator.migrations, func(i, j int) bool {
+		return migrator.migrations[i].Version < migrator.migrations[j].Version
+	})
+
+	return migrator, nil
+}
+
+// Up() applies all the pending migrations in ascending order. If the database is
+// already at the latest version, ErrNoChange is returned.
+func (m *Migrator) Up(ctx context.Context) error {
+	if len(m.migrations) == 0 {
+		return ErrNoChange
+	}
+	return m.Goto(ctx, m.migrations[len(m.migrations)-1].Version)
+}
+
+// Down() rolls back the most recently applied migration. If no migrations have
+// been applied, ErrNoChange is returned.
+func (m *Migrator) Down(ctx context.Context) error {
+	return m.withLock(ctx, func(conn *sql.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for i := len(m.migrations) - 1; i >= 0; i-- {
+			if _, ok := applied[m.migrations[i].Version]; ok {
+				return m.run(ctx, conn, m.migrations[i], false)
+			}
+		}
+
+		return ErrNoChange
+	})
+}
+
+// Goto() migrates the database up or down so that exactly the migrations with a
+// version less than or equal to the target are applied. A target of 0 rolls back
+// everything.
+func (m *Migrator) Goto(ctx context.Context, target int64) error {
+	if target != 0 && !m.known(target) {
+		return fmt.Errorf("%w: %d", ErrUnknownVersion, target)
+	}
+
+	return m.withLock(ctx, func(conn *sql.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		changed := false
+
+		// Roll back anything above the target first, newest first...
+		for i := len(m.migrations) - 1; i >= 0; i-- {
+			migration := m.migrations[i]
+			if _, ok := applied[migration.Version]; ok && migration.Version > target {
+				if err := m.run(ctx, conn, migration, false); err != nil {
+					return err
+				}
+				changed = true
+			}
+		}
+
+		// ...then apply anything at or below the target which is missing, oldest first.
+		for _, migration := range m.migrations {
+			if _, ok := applied[migration.Version]; !ok && migration.Version <= target {
+				if err := m.run(ctx, conn, migration, true); err != nil {
+					return err
+				}
+				changed = true
+			}
+		}
+
+		if !changed {
+			return ErrNoChange
+		}
+		return nil
+	})
+}
+
+// Status() returns every known migration along with whether it has been applied.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	var statuses []Status
+
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range m.migrations {
+			appliedAt, ok := applied[migration.Version]
+			statuses = append(statuses, Status{
+				Migration: migration,
+				Applied:   ok,
+				AppliedAt: appliedAt,
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return statuses, nil
+}
+
+func (m *Migrator) known(version int64) bool {
+	for _, migration := range m.migrations {
+		if migration.Version == version {
+			return true
+		}
+	}
+	return false
+}
+
+// withLock() runs fn on a single connection while holding the migration advisory
+// lock, creating the schema_migrations table first if it doesn't exist yet.
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	// Advisory locks belong to a session, so we need to make sure that the lock,
+	// the migrations and the unlock all happen on the same connection.
+	conn, err := m.DB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", lockKey)
+	if err != nil {
+		return err
+	}
+	defer conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", lockKey)
+
+	query := `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version bigint PRIMARY KEY,
+			applied_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+		)`
+
+	_, err = conn.ExecContext(ctx, query)
+	if err != nil {
+		return err
+	}
+
+	return fn(conn)
+}
+
+// applied() returns the versions recorded in schema_migrations, mapped to the time
+// they were applied.
+func (m *Migrator) applied(ctx context.Context, conn *sql.Conn) (map[int64]time.Time, error) {
+	rows, err := conn.QueryContext(ctx, "SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int64]time.Time)
+
+	for rows.Next() {
+		var (
+			version   int64
+			appliedAt time.Time
+		)
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return applied, nil
+}
+
+// run() applies (up == true) or rolls back a single migration. The SQL and the
+// change to schema_migrations happen in the same transaction, so a failing
+// migration leaves both the schema and the version table untouched.
+func (m *Migrator) run(ctx context.Context, conn *sql.Conn, migration Migration, up bool) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	statement, record := migration.Down, "DELETE FROM schema_migrations WHERE version = $1"
+	direction := "down"
+	if up {
+		statement, record = migration.Up, "INSERT INTO schema_migrations (version) VALUES ($1)"
+		direction = "up"
+	}
+
+	_, err = tx.ExecContext(ctx, statement)
+	if err != nil {
+		return fmt.Errorf("migration %d_%s (%s): %w", migration.Version, migration.Name, direction, err)
+	}
+
+	_, err = tx.ExecContext(ctx, record, migration.Version)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
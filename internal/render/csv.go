@@ -0,0 +1,112 @@
+package render
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+)
+
+// marshalCSV() writes the list of objects in v (see Tabular) as CSV, with a header
+// row. The columns are the keys of the objects, in the order they're first seen.
+// Nested objects and lists are written as compact JSON, and nulls as empty cells.
+func marshalCSV(v any) ([]byte, error) {
+	doc, err := document(v)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, ok := table(doc)
+	if !ok {
+		return nil, ErrNotTabular
+	}
+
+	var columns []string
+	seen := make(map[string]bool)
+	for _, row := range rows {
+		for _, m := range row {
+			if !seen[m.key] {
+				seen[m.key] = true
+				columns = append(columns, m.key)
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+
+	if len(columns) > 0 {
+		err = w.Write(columns)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, row := range rows {
+		cells := make(map[string]string, len(row))
+		for _, m := range row {
+			cells[m.key], err = csvCell(m.value)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		record := make([]string, len(columns))
+		for i, column := range columns {
+			record[i] = cells[column]
+		}
+
+		err = w.Write(record)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+// table() returns the rows of the only list of objects in the top-level object.
+func table(doc any) ([]object, bool) {
+	obj, ok := doc.(object)
+	if !ok {
+		return nil, false
+	}
+
+	var rows []object
+	found := 0
+
+	for _, m := range obj {
+		list, ok := m.value.([]any)
+		if !ok {
+			continue
+		}
+
+		objects := make([]object, 0, len(list))
+		for _, item := range list {
+			row, ok := item.(object)
+			if !ok {
+				break
+			}
+			objects = append(objects, row)
+		}
+
+		if len(objects) == len(list) {
+			rows = objects
+			found++
+		}
+	}
+
+	return rows, found == 1
+}
+
+func csvCell(value any) (string, error) {
+	switch value.(type) {
+	case nil:
+		return "", nil
+	case object, []any:
+		js, err := json.Marshal(value)
+		return string(js), err
+	default:
+		return scalarString(value), nil
+	}
+}
@@ -0,0 +1,139 @@
+package render
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// marshalMessagePack() encodes v in MessagePack (https://msgpack.org). Each value
+// uses the most compact encoding the specification allows. Numbers are written as
+// integers when they are whole and fit in 64 bits, and as float 64 otherwise.
+func marshalMessagePack(v any) ([]byte, error) {
+	doc, err := document(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+
+	err = encodeMessagePack(&buf, doc)
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func encodeMessagePack(buf *bytes.Buffer, value any) error {
+	switch value := value.(type) {
+	case nil:
+		buf.WriteByte(0xc0)
+
+	case bool:
+		if value {
+			buf.WriteByte(0xc3)
+		} else {
+			buf.WriteByte(0xc2)
+		}
+
+	case json.Number:
+		if i, err := value.Int64(); err == nil {
+			writeMessagePackInt(buf, i)
+		} else if u, err := strconv.ParseUint(value.String(), 10, 64); err == nil {
+			buf.WriteByte(0xcf)
+			buf.Write(binary.BigEndian.AppendUint64(nil, u))
+		} else if f, err := value.Float64(); err == nil {
+			buf.WriteByte(0xcb)
+			buf.Write(binary.BigEndian.AppendUint64(nil, math.Float64bits(f)))
+		} else {
+			return fmt.Errorf("render: invalid number %q", value)
+		}
+
+	case string:
+		writeMessagePackHeader(buf, len(value), 0xa0, 31, 0xd9, 0xda, 0xdb)
+		buf.WriteString(value)
+
+	case []any:
+		writeMessagePackHeader(buf, len(value), 0x90, 15, 0, 0xdc, 0xdd)
+		for _, item := range value {
+			err := encodeMessagePack(buf, item)
+			if err != nil {
+				return err
+			}
+		}
+
+	case object:
+		writeMessagePackHeader(buf, len(value), 0x80, 15, 0, 0xde, 0xdf)
+		for _, m := range value {
+			err := encodeMessagePack(buf, m.key)
+			if err != nil {
+				return err
+			}
+			err = encodeMessagePack(buf, m.value)
+			if err != nil {
+				return err
+			}
+		}
+
+	default:
+		return fmt.Errorf("render: unexpected document value of type %T", value)
+	}
+
+	return nil
+}
+
+// writeMessagePackHeader() writes the type and length of a string, array or map: the
+// fix variant (fix|n) when n <= fixMax, otherwise the 8-bit (if the type has one),
+// 16-bit or 32-bit length variant.
+func writeMessagePackHeader(buf *bytes.Buffer, n int, fix byte, fixMax int, b8, b16, b32 byte) {
+	switch {
+	case n <= fixMax:
+		buf.WriteByte(fix | byte(n))
+	case b8 != 0 && n <= math.MaxUint8:
+		buf.WriteByte(b8)
+		buf.WriteByte(byte(n))
+	case n <= math.MaxUint16:
+		buf.WriteByte(b16)
+		buf.Write(binary.BigEndian.AppendUint16(nil, uint16(n)))
+	default:
+		buf.WriteByte(b32)
+		buf.Write(binary.BigEndian.AppendUint32(nil, uint32(n)))
+	}
+}
+
+func writeMessagePackInt(buf *bytes.Buffer, i int64) {
+	switch {
+	case i >= 0 && i <= 0x7f:
+		buf.WriteByte(byte(i))
+	case i >= -32 && i < 0:
+		buf.WriteByte(byte(i))
+	case i >= 0 && i <= math.MaxUint8:
+		buf.WriteByte(0xcc)
+		buf.WriteByte(byte(i))
+	case i >= 0 && i <= math.MaxUint16:
+		buf.WriteByte(0xcd)
+		buf.Write(binary.BigEndian.AppendUint16(nil, uint16(i)))
+	case i >= 0 && i <= math.MaxUint32:
+		buf.WriteByte(0xce)
+		buf.Write(binary.BigEndian.AppendUint32(nil, uint32(i)))
+	case i >= 0:
+		buf.WriteByte(0xcf)
+		buf.Write(binary.BigEndian.AppendUint64(nil, uint64(i)))
+	case i >= math.MinInt8:
+		buf.WriteByte(0xd0)
+		buf.WriteByte(byte(i))
+	case i >= math.MinInt16:
+		buf.WriteByte(0xd1)
+		buf.Write(binary.BigEndian.AppendUint16(nil, uint16(i)))
+	case i >= math.MinInt32:
+		buf.WriteByte(0xd2)
+		buf.Write(binary.BigEndian.AppendUint32(nil, uint32(i)))
+	default:
+		buf.WriteByte(0xd3)
+		buf.Write(binary.BigEndian.AppendUint64(nil, uint64(i)))
+	}
+}
@@ -0,0 +1,346 @@
+// Package render encodes response data in one of several representations (JSON, XML,
+// CSV and MessagePack), and picks the representation a client asked for in its
+// Accept header.
+//
+// Every representation is derived from the JSON encoding of the data: the value is
+// first marshaled with encoding/json, and the non-JSON formats then re-encode the
+// resulting document. So custom MarshalJSON methods (like data.Runtime's) and json
+// struct tags apply to all of them, and keys come out in the same order everywhere.
+package render
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// ErrNotTabular is returned when the CSV format is asked to encode data which
+// doesn't contain a list of objects. See Tabular().
+var ErrNotTabular = errors.New("render: data doesn't contain exactly one list of objects")
+
+// A Format is a representation of response data.
+type Format struct {
+	// MediaType is the canonical media type of the format, for example "application/json".
+	MediaType string
+	// ContentType is the value for the Content-Type header.
+	ContentType string
+
+	aliases []string
+	marshal func(v any) ([]byte, error)
+}
+
+// Marshal encodes v in the format.
+func (f *Format) Marshal(v any) ([]byte, error) {
+	return f.marshal(v)
+}
+
+// The supported formats.
+var (
+	JSON = &Format{
+		MediaType:   "application/json",
+		ContentType: "application/json",
+		marshal:     marshalJSON,
+	}
+	XML = &Format{
+		MediaType:   "application/xml",
+		ContentType: "application/xml; charset=utf-8",
+		aliases:     []string{"text/xml"},
+		marshal:     marshalXML,
+	}
+	CSV = &Format{
+		MediaType:   "text/csv",
+		ContentType: "text/csv; charset=utf-8",
+		marshal:     marshalCSV,
+	}
+	MessagePack = &Format{
+		MediaType:   "application/msgpack",
+		ContentType: "application/msgpack",
+		aliases:     []string{"application/x-msgpack", "application/vnd.msgpack"},
+		marshal:     marshalMessagePack,
+	}
+)
+
+// Formats lists every supported format, in order of preference. JSON comes first,
+// so it's the one used when the client doesn't express a preference.
+var Formats = []*Format{JSON, XML, CSV, MessagePack}
+
+// ObjectFormats lists the formats which can encode any value, which is all of them
+// except CSV, in the same order as Formats.
+var ObjectFormats = []*Format{JSON, XML, MessagePack}
+
+// Offers returns the formats which can encode v. That's all of them, except that
+// CSV is only offered for tabular data.
+func Offers(v any) []*Format {
+	if Tabular(v) {
+		return Formats
+	}
+	return ObjectFormats
+}
+
+// Tabular reports whether v is a map or struct with exactly one field holding a list
+// of objects (structs or maps), such as the envelope of a list of movies. In CSV,
+// the list is written out as the table and any other fields are left out.
+func Tabular(v any) bool {
+	rv := indirect(reflect.ValueOf(v))
+
+	var fields []reflect.Value
+	switch rv.Kind() {
+	case reflect.Map:
+		iter := rv.MapRange()
+		for iter.Next() {
+			fields = append(fields, iter.Value())
+		}
+	case reflect.Struct:
+		for i := 0; i < rv.NumField(); i++ {
+			if rv.Type().Field(i).IsExported() {
+				fields = append(fields, rv.Field(i))
+			}
+		}
+	default:
+		return false
+	}
+
+	lists := 0
+	for _, field := range fields {
+		field = indirect(field)
+		if field.Kind() != reflect.Slice && field.Kind() != reflect.Array {
+			continue
+		}
+
+		elem := field.Type().Elem()
+		for elem.Kind() == reflect.Pointer {
+			elem = elem.Elem()
+		}
+		if elem.Kind() == reflect.Struct || elem.Kind() == reflect.Map {
+			lists++
+		}
+	}
+
+	return lists == 1
+}
+
+// indirect() follows pointers and interfaces down to the underlying value.
+func indirect(rv reflect.Value) reflect.Value {
+	for rv.Kind() == reflect.Pointer || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return reflect.Value{}
+		}
+		rv = rv.Elem()
+	}
+	return rv
+}
+
+// Negotiate picks the offer the client prefers according to the Accept header, as
+// described in RFC 9110 section 12.5.1. Each offer gets the quality value of the
+// most specific media range that matches it, and the offer with the highest quality
+// wins, with ties going to the earlier offer. An empty header accepts anything.
+// It returns false if none of the offers is acceptable.
+func Negotiate(accept string, offers []*Format) (*Format, bool) {
+	if len(offers) == 0 {
+		return nil, false
+	}
+
+	if strings.TrimSpace(accept) == "" {
+		return offers[0], true
+	}
+
+	ranges := parseAccept(accept)
+
+	var (
+		best        *Format
+		bestQuality float64
+	)
+
+	for _, offer := range offers {
+		quality := offer.quality(ranges)
+		if quality > bestQuality {
+			best, bestQuality = offer, quality
+		}
+	}
+
+	return best, best != nil
+}
+
+// A mediaRange is one element of an Accept header, e.g. "text/*;q=0.5".
+type mediaRange struct {
+	typ, subtype string
+	quality      float64
+}
+
+// parseAccept() parses an Accept header. Malformed elements are skipped.
+func parseAccept(accept string) []mediaRange {
+	var ranges []mediaRange
+
+	for _, element := range strings.Split(accept, ",") {
+		mediaType, params, _ := strings.Cut(element, ";")
+
+		typ, subtype, ok := strings.Cut(strings.ToLower(strings.TrimSpace(mediaType)), "/")
+		if !ok || typ == "" || subtype == "" || (typ == "*" && subtype != "*") {
+			continue
+		}
+
+		r := mediaRange{typ: typ, subtype: subtype, quality: 1}
+
+		valid := true
+		for _, param := range strings.Split(params, ";") {
+			name, value, _ := strings.Cut(param, "=")
+			if !strings.EqualFold(strings.TrimSpace(name), "q") {
+				continue
+			}
+
+			q, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if err != nil || q < 0 || q > 1 {
+				valid = false
+				break
+			}
+			r.quality = q
+		}
+
+		if valid {
+			ranges = append(ranges, r)
+		}
+	}
+
+	return ranges
+}
+
+// quality() returns the quality value of the most specific range matching the format
+// (under any of its names), or 0 if none does.
+func (f *Format) quality(ranges []mediaRange) float64 {
+	specificity, quality := -1, 0.0
+
+	for _, name := range append([]string{f.MediaType}, f.aliases...) {
+		typ, subtype, _ := strings.Cut(name, "/")
+
+		for _, r := range ranges {
+			var s int
+			switch {
+			case r.typ == typ && r.subtype == subtype:
+				s = 2
+			case r.typ == typ && r.subtype == "*":
+				s = 1
+			case r.typ == "*":
+				s = 0
+			default:
+				continue
+			}
+
+			if s > specificity || (s == specificity && r.quality > quality) {
+				specificity, quality = s, r.quality
+			}
+		}
+	}
+
+	return quality
+}
+
+func marshalJSON(v any) ([]byte, error) {
+	js, err := json.MarshalIndent(v, "", "\t")
+	if err != nil {
+		return nil, err
+	}
+
+	// Append a new line to make it nice in the terminal.
+	return append(js, '\n'), nil
+}
+
+// An object is a decoded JSON object which remembers the order of its members.
+type object []member
+
+type member struct {
+	key   string
+	value any
+}
+
+// MarshalJSON encodes the object with its members in their original order. It's used
+// for nested values in CSV cells.
+func (o object) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+
+	buf.WriteByte('{')
+	for i, m := range o {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+
+		key, err := json.Marshal(m.key)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(m.value)
+		if err != nil {
+			return nil, err
+		}
+
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+
+	return buf.Bytes(), nil
+}
+
+// document() marshals v to JSON and decodes it again into a tree of object, []any,
+// string, json.Number, bool and nil values, which the non-JSON formats encode.
+func document(v any) (any, error) {
+	js, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(js))
+	dec.UseNumber()
+
+	return decodeValue(dec)
+}
+
+func decodeValue(dec *json.Decoder) (any, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch tok {
+	case json.Delim('{'):
+		obj := object{}
+		for dec.More() {
+			key, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+
+			value, err := decodeValue(dec)
+			if err != nil {
+				return nil, err
+			}
+
+			obj = append(obj, member{key: key.(string), value: value})
+		}
+
+		// Consume the closing '}'.
+		_, err = dec.Token()
+		return obj, err
+
+	case json.Delim('['):
+		arr := []any{}
+		for dec.More() {
+			value, err := decodeValue(dec)
+			if err != nil {
+				return nil, err
+			}
+
+			arr = append(arr, value)
+		}
+
+		// Consume the closing ']'.
+		_, err = dec.Token()
+		return arr, err
+
+	default:
+		return tok, nil
+	}
+}
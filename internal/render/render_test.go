@@ -0,0 +1,129 @@
+package render
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		name   string
+		accept string
+		offers []*Format
+		want   *Format
+	}{
+		{"Empty", "", Formats, JSON},
+		{"Wildcard", "*/*", Formats, JSON},
+		{"Exact", "application/msgpack", Formats, MessagePack},
+		{"Alias", "text/xml", Formats, XML},
+		{"Case insensitive", "Application/XML", Formats, XML},
+		{"Subtype wildcard", "text/*", Formats, XML}, // via the text/xml alias
+		{"Quality", "application/json;q=0.2, application/xml;q=0.8", Formats, XML},
+		{"Tie goes to first offer", "application/xml, application/json", Formats, JSON},
+		{"Most specific range wins", "application/*;q=0.1, application/xml", Formats, XML},
+		{"Excluded by q=0", "*/*, application/json;q=0", Formats, XML},
+		{"Not offered", "text/csv", []*Format{JSON, XML}, nil},
+		{"Unsupported", "text/html", Formats, nil},
+		{"Malformed ranges are skipped", "text, application/xml;q=2, application/msgpack", Formats, MessagePack},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := Negotiate(tt.accept, tt.offers)
+
+			if ok != (tt.want != nil) || got != tt.want {
+				t.Errorf("got %v, %t; want %v", got, ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestTabular(t *testing.T) {
+	type row struct{ A int }
+
+	tests := []struct {
+		name string
+		v    any
+		want bool
+	}{
+		{"List of structs", map[string]any{"rows": []*row{}, "metadata": row{}}, true},
+		{"List of maps", map[string]any{"rows": []map[string]int{}}, true},
+		{"List of strings", map[string]any{"rows": []string{}}, false},
+		{"Two lists", map[string]any{"a": []row{}, "b": []row{}}, false},
+		{"Single struct", map[string]any{"row": row{}}, false},
+		{"Not an object", []row{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Tabular(tt.v); got != tt.want {
+				t.Errorf("got %t; want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMarshalMessagePack(t *testing.T) {
+	tests := []struct {
+		name string
+		v    any
+		want []byte
+	}{
+		{"Nil", nil, []byte{0xc0}},
+		{"Booleans", []bool{true, false}, []byte{0x92, 0xc3, 0xc2}},
+		{"Positive fixint", 127, []byte{0x7f}},
+		{"Negative fixint", -32, []byte{0xe0}},
+		{"uint 8", 200, []byte{0xcc, 0xc8}},
+		{"uint 16", 1000, []byte{0xcd, 0x03, 0xe8}},
+		{"int 8", -100, []byte{0xd0, 0x9c}},
+		{"int 32", -100000, []byte{0xd2, 0xff, 0xfe, 0x79, 0x60}},
+		{"uint 64", uint64(1 << 63), []byte{0xcf, 0x80, 0, 0, 0, 0, 0, 0, 0}},
+		{"Float", 1.5, []byte{0xcb, 0x3f, 0xf8, 0, 0, 0, 0, 0, 0}},
+		{"fixstr", "abc", []byte{0xa3, 'a', 'b', 'c'}},
+		{"str 8", string(bytes.Repeat([]byte("a"), 32)), append([]byte{0xd9, 32}, bytes.Repeat([]byte("a"), 32)...)},
+		{"Map keeps key order", struct{ B, A int }{1, 2}, []byte{0x82, 0xa1, 'B', 0x01, 0xa1, 'A', 0x02}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := MessagePack.Marshal(tt.v)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("got % x; want % x", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMarshalXML(t *testing.T) {
+	v := map[string]any{
+		"error": map[string]any{"title": "must be provided", "1st": nil},
+	}
+
+	got, err := XML.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `<?xml version="1.0" encoding="UTF-8"?>
+<response>
+	<error>
+		<entry key="1st" nil="true"></entry>
+		<title>must be provided</title>
+	</error>
+</response>
+`
+	if string(got) != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestMarshalCSVNotTabular(t *testing.T) {
+	_, err := CSV.Marshal(map[string]any{"movie": struct{ ID int }{1}})
+	if err != ErrNotTabular {
+		t.Errorf("got error %v; want %v", err, ErrNotTabular)
+	}
+}
@@ -0,0 +1,131 @@
+package render
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// marshalXML() encodes v as an XML document with a <response> root element. Object
+// members become elements named after their keys, list items become <item> elements
+// and nulls become empty elements with a nil="true" attribute. Keys which aren't
+// valid XML names are written as <entry key="...">.
+//
+// For example {"movie": {"Title": "Casablanca", "Genres": ["drama", "war"]}} becomes
+//
+//	<response>
+//		<movie>
+//			<Title>Casablanca</Title>
+//			<Genres>
+//				<item>drama</item>
+//				<item>war</item>
+//			</Genres>
+//		</movie>
+//	</response>
+func marshalXML(v any) ([]byte, error) {
+	doc, err := document(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+
+	enc := xml.NewEncoder(&buf)
+	enc.Indent("", "\t")
+
+	err = encodeXML(enc, "response", doc)
+	if err != nil {
+		return nil, err
+	}
+
+	err = enc.Flush()
+	if err != nil {
+		return nil, err
+	}
+
+	buf.WriteByte('\n')
+	return buf.Bytes(), nil
+}
+
+func encodeXML(enc *xml.Encoder, name string, value any) error {
+	start := xml.StartElement{Name: xml.Name{Local: name}}
+	if !isXMLName(name) {
+		start = xml.StartElement{
+			Name: xml.Name{Local: "entry"},
+			Attr: []xml.Attr{{Name: xml.Name{Local: "key"}, Value: name}},
+		}
+	}
+
+	if value == nil {
+		start.Attr = append(start.Attr, xml.Attr{Name: xml.Name{Local: "nil"}, Value: "true"})
+	}
+
+	err := enc.EncodeToken(start)
+	if err != nil {
+		return err
+	}
+
+	switch value := value.(type) {
+	case object:
+		for _, m := range value {
+			err = encodeXML(enc, m.key, m.value)
+			if err != nil {
+				return err
+			}
+		}
+	case []any:
+		for _, item := range value {
+			err = encodeXML(enc, "item", item)
+			if err != nil {
+				return err
+			}
+		}
+	case nil:
+	default:
+		err = enc.EncodeToken(xml.CharData(scalarString(value)))
+		if err != nil {
+			return err
+		}
+	}
+
+	return enc.EncodeToken(start.End())
+}
+
+// isXMLName() reports whether s can be used as an element name as it is. This is a
+// conservative subset of the XML Name production: a letter or underscore followed by
+// letters, digits, underscores, hyphens and dots, not starting with "xml".
+func isXMLName(s string) bool {
+	if s == "" || strings.HasPrefix(strings.ToLower(s), "xml") {
+		return false
+	}
+
+	for i, r := range s {
+		switch {
+		case unicode.IsLetter(r) || r == '_':
+		case i > 0 && (unicode.IsDigit(r) || r == '-' || r == '.'):
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+// scalarString() returns the text of a string, number or boolean document value.
+func scalarString(value any) string {
+	switch value := value.(type) {
+	case string:
+		return value
+	case json.Number:
+		return value.String()
+	case bool:
+		return strconv.FormatBool(value)
+	default:
+		return fmt.Sprint(value)
+	}
+}
@@ -0,0 +1,52 @@
+package vcs
+
+import (
+	"runtime/debug"
+)
+
+// Info holds the version control details that the Go toolchain stamps into the
+// binary when it's built from a git checkout (see `go version -m <binary>`).
+type Info struct {
+	Revision   string
+	CommitTime string
+	Modified   bool
+	GoVersion  string
+}
+
+// Read() returns the version control details of the running binary. The fields are
+// left empty if the information isn't available, for example when running with
+// `go run` or when the binary was built with -buildvcs=false.
+func Read() Info {
+	var info Info
+
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+
+	info.GoVersion = bi.GoVersion
+
+	for _, s := range bi.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			info.Revision = s.Value
+		case "vcs.time":
+			info.CommitTime = s.Value
+		case "vcs.modified":
+			info.Modified = s.Value == "true"
+		}
+	}
+
+	return info
+}
+
+// ModuleVersion() returns the version of the main module, as recorded by `go install
+// module@version`. Binaries built from a checkout report "(devel)", in which case
+// the empty string is returned.
+func ModuleVersion() string {
+	bi, ok := debug.ReadBuildInfo()
+	if !ok || bi.Main.Version == "(devel)" {
+		return ""
+	}
+	return bi.Main.Version
+}
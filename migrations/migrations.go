@@ -0,0 +1,10 @@
+// Package migrations holds the versioned SQL schema migrations for the application.
+// Each migration is a pair of files named "<version>_<name>.up.sql" and
+// "<version>_<name>.down.sql", and they're embedded into the binary so that
+// `api migrate` doesn't need the files to exist on disk at runtime.
+package migrations
+
+import "embed"
+
+//go:embed *.sql
+var FS embed.FS